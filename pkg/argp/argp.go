@@ -1,35 +1,120 @@
 package argp
 
 import (
+	"cmp"
+	"context"
+	"encoding"
+	"errors"
 	"fmt"
 	motmedelErrors "github.com/Motmedel/utils_go/pkg/errors"
 	argpErrors "github.com/vphpersson/argp/pkg/errors"
 	argpVariable "github.com/vphpersson/argp/pkg/types/variable"
+	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"reflect"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
 	"unicode"
 	"unicode/utf8"
 )
 
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
 // Cmd is a command.
 type Cmd interface {
 	Run() error
 }
 
+// ContextCmd is a command that runs with a context, which is cancelled on a signal when parsing with `Argp.ParseContext`.
+type ContextCmd interface {
+	Run(ctx context.Context) error
+}
+
+// Beforer is a command with setup that runs before its own Run method or that of any of its sub commands.
+type Beforer interface {
+	Before(ctx context.Context) error
+}
+
+// Afterer is a command with teardown that runs after its own Run method or that of any of its sub commands. It receives the error returned so far and returns the error to pass on.
+type Afterer interface {
+	After(ctx context.Context, err error) error
+}
+
 // Argp is a (sub) command parser.
 type Argp struct {
 	Cmd
 	Description string
 
-	parent *Argp
-	name   string
-	vars   []*argpVariable.Variable
-	cmds   map[string]*Argp
-	help   bool
+	// LongDescription is shown in the help of the command instead of Description, which is still used in the command list of the parent command.
+	LongDescription string
+
+	// Examples are worked examples shown in the help of the command.
+	Examples []Example
+
+	// Epilogue is shown at the end of the help of the command.
+	Epilogue string
+
+	// Name is the command name shown in the help. It defaults to the base name of os.Args[0] for the main command.
+	Name string
+
+	// Stdout and Stderr are where the help and errors are written. If nil, the writers of the parent command are used, or else os.Stdout and os.Stderr.
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// HelpTemplate is the text/template used by `Argp.PrintHelp`, which is executed with a Help value. If empty, the template of the parent command is used, or else DefaultHelpTemplate.
+	HelpTemplate string
+
+	// DeclarationOrder lists options in the help in the order they were added instead of alphabetically. It applies to all sub commands.
+	DeclarationOrder bool
+
+	// HelpWidth is the width that the help is wrapped to. If zero, the width of the parent command is used, or else the COLUMNS environment variable, or 80.
+	HelpWidth int
+
+	// LookupEnv looks up environment variables. If nil, the function of the parent command is used, or else os.LookupEnv.
+	LookupEnv func(key string) (string, bool)
+
+	// AllowAbbreviation lets a unique prefix of a long option or sub command name resolve to it, e.g. --verb for --verbose. It applies to all sub commands.
+	AllowAbbreviation bool
+
+	// Signals cancel the context passed by `Argp.ParseContext`, and a second signal exits the program. If nil, SIGINT and SIGTERM are used.
+	Signals []os.Signal
+
+	// StrictCommands reports an unknown sub command as an error instead of treating it as a positional argument. It applies to all sub commands.
+	StrictCommands bool
+
+	// ResponseFiles expands arguments of the form @file into the arguments in the file, one or more per line with shell-like quoting, before parsing. Response files may include other response files, and @@ escapes an argument starting with @. Only the setting of the main command is used.
+	ResponseFiles bool
+
+	// PassUnknown adds unknown options in order to the rest argument or the remaining arguments instead of returning ErrUnknownOption, see also `Argp.AddPassThrough`. Indexed and trailing arguments are only set from positional arguments, and unknown options before a sub command are passed on to it. Only values attached with = are kept with their option.
+	PassUnknown bool
+
+	// StopAtPositional ends option parsing at the first positional argument like --, so that the arguments after it are passed on untouched, e.g. the options of a program to run.
+	StopAtPositional bool
+
+	// PosixlyCorrect stops at the first positional argument like StopAtPositional when the POSIXLY_CORRECT environment variable is set. It applies to all sub commands.
+	PosixlyCorrect bool
+
+	// CollectErrors continues parsing after an invalid argument and returns all errors in argument order, joined with errors.Join. It applies to all sub commands.
+	CollectErrors bool
+
+	parent     *Argp
+	contextCmd ContextCmd
+	aliases    []string
+	vars       []*argpVariable.Variable
+	cmds       map[string]*Argp
+	help       bool
+	topics     []helpTopic
+	before     []func(context.Context) error
+	after      []func(context.Context, error) error
 }
 
 // New returns a new command parser that can set options and returns the remaining arguments from `Argp.Parse`.
@@ -37,15 +122,34 @@ func New(description string) *Argp {
 	return NewCmd(nil, description)
 }
 
-// NewCmd returns a new command parser that invokes the Run method of the passed command structure. The `Argp.Parse()` function will not return and will call os.Exit() with 0, 1 or 2 as the argument.
+// NewCmd returns a new command parser that invokes the Run method of the passed command structure. The `Argp.Main()` function will not return and will call os.Exit() with 0, 1 or 2 as the argument.
 func NewCmd(cmd Cmd, description string) *Argp {
+	return newCmd(nil, cmd, description)
+}
+
+// NewContextCmd returns a new command parser like `NewCmd` for a command whose Run method takes a context.
+func NewContextCmd(cmd ContextCmd, description string) *Argp {
+	return newCmd(nil, cmd, description)
+}
+
+// newCmd returns a new command parser for cmd, which is nil or implements either Cmd or ContextCmd.
+func newCmd(parent *Argp, cmd any, description string) *Argp {
 	argp := &Argp{
-		Cmd:         cmd,
 		Description: description,
-		name:        filepath.Base(os.Args[0]),
+		parent:      parent,
+		Name:        filepath.Base(os.Args[0]),
 		cmds:        map[string]*Argp{},
 	}
 	if cmd != nil {
+		switch c := cmd.(type) {
+		case Cmd:
+			argp.Cmd = c
+		case ContextCmd:
+			argp.contextCmd = c
+		default:
+			panic("cmd: must implement Run() error or Run(context.Context) error")
+		}
+
 		v := reflect.ValueOf(cmd)
 		if v.Type().Kind() != reflect.Ptr {
 			panic("cmd: must pass a pointer to struct")
@@ -56,9 +160,10 @@ func NewCmd(cmd Cmd, description string) *Argp {
 		}
 
 		maxIndex := -1
-		for j := range v.NumField() {
-			tfield := v.Type().Field(j)
-			vfield := v.Field(j)
+		maxTrailing := 0
+		for _, field := range argp.structFields(v, "") {
+			tfield := field.StructField
+			vfield := field.value
 			if vfield.IsValid() {
 				variable := &argpVariable.Variable{}
 				variable.Value = vfield
@@ -66,6 +171,29 @@ func NewCmd(cmd Cmd, description string) *Argp {
 				variable.Index = -1
 				option := reflect.TypeOf(cmd).String() + "." + tfield.Name
 
+				if cmdName, isCmd := tfield.Tag.Lookup("cmd"); isCmd {
+					// nested sub command
+					if vfield.Kind() != reflect.Ptr || vfield.Type().Elem().Kind() != reflect.Struct {
+						panic(fmt.Sprintf("%v: sub command must be a pointer to struct", option))
+					} else if vfield.IsNil() {
+						vfield.Set(reflect.New(vfield.Type().Elem()))
+					}
+					if cmdName == "" {
+						cmdName = fromFieldname(tfield.Name)
+					}
+					sub := argp.addCmd(vfield.Interface(), cmdName, tfield.Tag.Get("desc"))
+					if alias := tfield.Tag.Get("alias"); alias != "" {
+						sub.AddAlias(strings.Split(alias, ",")...)
+					}
+					continue
+				}
+
+				if parentCmd := argp.findParentCmd(vfield.Type()); parentCmd != nil {
+					// reference to a parent command
+					vfield.Set(reflect.ValueOf(parentCmd))
+					continue
+				}
+
 				if !isValidType(vfield.Type()) {
 					panic(fmt.Sprintf("unsupported type %s", vfield.Type()))
 				}
@@ -75,6 +203,12 @@ func NewCmd(cmd Cmd, description string) *Argp {
 				index := tfield.Tag.Get("index")
 				def, hasDef := tfield.Tag.Lookup("default")
 				description := tfield.Tag.Get("desc")
+				persistent := tfield.Tag.Get("persistent")
+				section := tfield.Tag.Get("section")
+				passThrough := tfield.Tag.Get("passthrough")
+				minCount, maxCount := tfield.Tag.Get("min"), tfield.Tag.Get("max")
+				nargs := tfield.Tag.Get("nargs")
+				implicit, isOptional := tfield.Tag.Lookup("optional")
 
 				if hasName {
 					variable.Name = strings.ToLower(name)
@@ -82,6 +216,10 @@ func NewCmd(cmd Cmd, description string) *Argp {
 				if variable.Name == "" {
 					variable.Name = short
 				}
+				if _, hasPrefix := tfield.Tag.Lookup("prefix"); hasPrefix {
+					panic(fmt.Sprintf("%v: prefix can only be set on an embedded struct", option))
+				}
+				variable.Name = field.prefix + variable.Name
 
 				if !isValidName(variable.Name) {
 					panic(fmt.Sprintf("%v: invalid option name: --%v", option, variable.Name))
@@ -111,31 +249,109 @@ func NewCmd(cmd Cmd, description string) *Argp {
 							panic(fmt.Sprintf("%v: rest option already exists", option))
 						} else if def != "" {
 							panic(fmt.Sprintf("%v: rest option can not have a default value", option))
-						} else if variable.Value.Kind() != reflect.Slice || variable.Value.Type().Elem().Kind() != reflect.String {
-							panic(fmt.Sprintf("%v: rest option must be of type []string", option))
+						} else if variable.Value.Kind() != reflect.Slice {
+							panic(fmt.Sprintf("%v: rest option must be a slice", option))
 						}
 						variable.Rest = true
 					} else {
 						i, err := strconv.Atoi(index)
-						if err != nil || i < 0 {
-							panic(fmt.Sprintf("%v: index must be a non-negative integer or *", option))
+						if err != nil {
+							panic(fmt.Sprintf("%v: index must be an integer or *", option))
+						} else if i < 0 {
+							// counted from the end, after the rest arguments
+							if argp.findTrailing(-i) != nil {
+								panic(fmt.Sprintf("%v: option index already exists: %v", option, i))
+							}
+							variable.Trailing = -i
+							if maxTrailing < -i {
+								maxTrailing = -i
+							}
 						} else if argp.findIndex(i) != nil {
 							panic(fmt.Sprintf("%v: option index already exists: %v", option, i))
+						} else {
+							variable.Index = i
+							if maxIndex < i {
+								maxIndex = i
+							}
 						}
-						variable.Index = i
-						if maxIndex < i {
-							maxIndex = i
-						}
 					}
 				}
 
+				if persistent != "" {
+					isPersistent, err := strconv.ParseBool(persistent)
+					if err != nil {
+						panic(fmt.Sprintf("%v: persistent must be a boolean", option))
+					} else if isPersistent && index != "" {
+						panic(fmt.Sprintf("%v: an argument can not be persistent", option))
+					}
+					variable.Persistent = isPersistent
+				}
+
+				if passThrough != "" {
+					isPassThrough, err := strconv.ParseBool(passThrough)
+					if err != nil {
+						panic(fmt.Sprintf("%v: passthrough must be a boolean", option))
+					} else if isPassThrough && (index != "" || short != "" || persistent != "" || hasDef) {
+						panic(fmt.Sprintf("%v: a pass-through field can not be an argument or have a short name, persistent or default value", option))
+					} else if isPassThrough && argp.findPassThrough() != nil {
+						panic(fmt.Sprintf("%v: pass-through field already exists", option))
+					} else if isPassThrough && variable.Value.Type() != reflect.TypeOf([]string{}) {
+						panic(fmt.Sprintf("%v: pass-through field must be of type []string", option))
+					}
+					variable.PassThrough = isPassThrough
+				}
+
+				if minCount != "" || maxCount != "" {
+					if index != "" && index != "*" {
+						panic(fmt.Sprintf("%v: only options and the rest can have a min or max count", option))
+					}
+					var err error
+					if variable.Min, err = parseCount(minCount); err != nil {
+						panic(fmt.Sprintf("%v: min must be a non-negative integer", option))
+					} else if variable.Max, err = parseCount(maxCount); err != nil {
+						panic(fmt.Sprintf("%v: max must be a non-negative integer", option))
+					} else if variable.Max != 0 && variable.Max < variable.Min {
+						panic(fmt.Sprintf("%v: max must not be smaller than min", option))
+					}
+				}
+
+				if nargs != "" {
+					n, err := strconv.Atoi(nargs)
+					if err != nil || n < 1 {
+						panic(fmt.Sprintf("%v: nargs must be a positive integer", option))
+					} else if index != "" {
+						panic(fmt.Sprintf("%v: an argument can not have nargs", option))
+					} else if !isValidNargs(variable.Value.Type(), n) {
+						panic(fmt.Sprintf("%v: nargs must match the length of an array or the number of fields of a struct, or be used with a slice", option))
+					}
+					variable.Nargs = n
+				}
+
+				if isOptional {
+					if index != "" {
+						panic(fmt.Sprintf("%v: an argument can not be optional", option))
+					} else if nargs != "" {
+						panic(fmt.Sprintf("%v: an option with nargs can not be optional", option))
+					}
+					setOptional(variable, implicit)
+				} else if index == "" && nargs == "" && isImplicitBool(variable.Value) {
+					setImplicitBool(variable)
+				}
+
+				if section != "" {
+					if index != "" {
+						panic(fmt.Sprintf("%v: an argument can not have a section", option))
+					}
+					variable.Section = section
+				}
+
 				if hasDef {
 					defVal := reflect.New(vfield.Type()).Elem()
-					if _, err := scanVar(defVal, "", splitArguments(def)); err != nil {
+					if _, err := scanOption(&argpVariable.Variable{Value: defVal, Nargs: variable.Nargs}, "", splitArguments(def), true); err != nil {
 						panic(fmt.Sprintf("%v: bad default value: %v", option, err))
 					}
 					variable.Default = defVal.Interface()
-				} else if variable.Index != -1 {
+				} else if variable.IsArgument() {
 					variable.Default = vfield.Interface()
 				}
 				if description != "" {
@@ -149,6 +365,11 @@ func NewCmd(cmd Cmd, description string) *Argp {
 				panic(fmt.Sprintf("option indices must be continuous: index %v is missing", i))
 			}
 		}
+		for i := 1; i <= maxTrailing; i++ {
+			if v := argp.findTrailing(i); v == nil {
+				panic(fmt.Sprintf("option indices must be continuous: index %v is missing", -i))
+			}
+		}
 	}
 	if argp.findName("help") == nil {
 		if argp.findShort('h') == nil {
@@ -162,21 +383,69 @@ func NewCmd(cmd Cmd, description string) *Argp {
 
 // AddCmd adds a sub command.
 func (argp *Argp) AddCmd(cmd Cmd, name, description string) *Argp {
+	return argp.addCmd(cmd, name, description)
+}
+
+// AddContextCmd adds a sub command like `Argp.AddCmd` whose Run method takes a context.
+func (argp *Argp) AddContextCmd(cmd ContextCmd, name, description string) *Argp {
+	return argp.addCmd(cmd, name, description)
+}
+
+func (argp *Argp) addCmd(cmd any, name, description string) *Argp {
 	if _, ok := argp.cmds[name]; ok {
 		panic(fmt.Sprintf("command already exists: %v", name))
 	} else if len(name) == 0 || name[0] == '-' {
 		panic("invalid command name")
 	}
 
-	sub := NewCmd(cmd, description)
-	sub.parent = argp
-	sub.name = name
+	sub := newCmd(argp, cmd, description)
+	sub.Name = name
 	argp.cmds[strings.ToLower(name)] = sub
 	return sub
 }
 
+// AddAlias adds alternative names by which the parent command selects this sub command.
+func (argp *Argp) AddAlias(aliases ...string) {
+	if argp.parent == nil {
+		panic("alias: not a sub command")
+	}
+	for _, alias := range aliases {
+		if _, ok := argp.parent.cmds[strings.ToLower(alias)]; ok {
+			panic(fmt.Sprintf("command already exists: %v", alias))
+		} else if len(alias) == 0 || alias[0] == '-' {
+			panic("invalid command alias")
+		}
+		argp.parent.cmds[strings.ToLower(alias)] = argp
+		argp.aliases = append(argp.aliases, strings.ToLower(alias))
+	}
+}
+
+// AddBefore adds a hook that runs before the Run method of the command or any of its sub commands. Hooks run from the root command down to the selected sub command.
+func (argp *Argp) AddBefore(hook func(ctx context.Context) error) {
+	argp.before = append(argp.before, hook)
+}
+
+// AddAfter adds a hook that runs after the Run method of the command or any of its sub commands. Hooks run from the selected sub command up to the root command and receive the error returned so far.
+func (argp *Argp) AddAfter(hook func(ctx context.Context, err error) error) {
+	argp.after = append(argp.after, hook)
+}
+
 // AddOpt adds an option.
 func (argp *Argp) AddOpt(dst any, short, name string, description string) {
+	argp.addOpt(dst, short, name, description)
+}
+
+// AddSectionOpt adds an option that is listed under a separate heading in the help. Sections are listed in the order they are first used.
+func (argp *Argp) AddSectionOpt(section string, dst any, short, name string, description string) {
+	argp.addOpt(dst, short, name, description).Section = section
+}
+
+// AddPersistentOpt adds an option that is also accepted by all sub commands, before or after the sub command name. Sub commands list it under "Global options" in their help.
+func (argp *Argp) AddPersistentOpt(dst any, short, name string, description string) {
+	argp.addOpt(dst, short, name, description).Persistent = true
+}
+
+func (argp *Argp) addOpt(dst any, short, name string, description string) *argpVariable.Variable {
 	v := reflect.ValueOf(dst)
 	_, isCustom := dst.(ArgumentScanner)
 	if !isCustom && v.Type().Kind() != reflect.Ptr {
@@ -216,11 +485,55 @@ func (argp *Argp) AddOpt(dst any, short, name string, description string) {
 		}
 		variable.Short = r
 	}
+	if isImplicitBool(v) {
+		setImplicitBool(variable)
+	}
 	if !isCustom {
 		variable.Default = v.Interface()
 	}
 	variable.Description = description
 	argp.vars = append(argp.vars, variable)
+	return variable
+}
+
+// AddOptionalOpt adds an option that takes a value only when attached with =, e.g. --color=never, and is set to implicit when given without a value, e.g. --color.
+func (argp *Argp) AddOptionalOpt(dst any, short, name, implicit, description string) {
+	setOptional(argp.addOpt(dst, short, name, description), implicit)
+}
+
+// setOptional makes the option take a value only when attached with =, and panics if the implicit value is invalid.
+func setOptional(v *argpVariable.Variable, implicit string) {
+	if _, isCustom := v.Value.Interface().(ArgumentScanner); !isCustom {
+		value := reflect.New(v.Value.Type()).Elem()
+		if _, err := scanValue(value, []string{implicit}); err != nil {
+			panic(fmt.Sprintf("%v: bad implicit value: %v", v.Name, err))
+		}
+	}
+	v.Optional = true
+	v.Implicit = implicit
+	v.NextBool = false
+}
+
+// setImplicitBool makes a bool option true when given without a value, unless it is followed by true or false, e.g. --dry-run false.
+func setImplicitBool(v *argpVariable.Variable) {
+	setOptional(v, "true")
+	v.NextBool = true
+}
+
+// nextBool returns the following argument if the option is a bool that takes it as its value, which is a valid bool, e.g. --dry-run false.
+func nextBool(v *argpVariable.Variable, args []string) (string, bool) {
+	if !v.NextBool || len(args) == 0 {
+		return "", false
+	} else if _, err := strconv.ParseBool(args[0]); err != nil {
+		return "", false
+	}
+	return args[0], true
+}
+
+// isImplicitBool returns true for a bool option, which is true when given without a value unless followed by true or false.
+func isImplicitBool(v reflect.Value) bool {
+	_, isCustom := v.Interface().(ArgumentScanner)
+	return !isCustom && v.Kind() == reflect.Bool
 }
 
 // AddArg adds an indexed value.
@@ -253,6 +566,37 @@ func (argp *Argp) AddArg(dst any, name, description string) {
 	argp.vars = append(argp.vars, variable)
 }
 
+// AddTrailingArg adds an argument after the rest arguments, e.g. DST in SRC... DST. Trailing arguments are taken from the end of the arguments, in the order they were added.
+func (argp *Argp) AddTrailingArg(dst any, name, description string) {
+	v := reflect.ValueOf(dst)
+	_, isCustom := dst.(ArgumentScanner)
+	if !isCustom && v.Type().Kind() != reflect.Ptr {
+		panic("dst: must pass pointer to variable or comply with argp.ArgumentScanner interface")
+	} else if !isCustom {
+		v = v.Elem()
+	}
+
+	variable := &argpVariable.Variable{}
+	variable.Value = v
+	variable.Name = strings.ToLower(name)
+	variable.Index = -1
+	variable.Trailing = 1
+	if !isValidType(v.Type()) {
+		panic(fmt.Sprintf("unsupported type %s", v.Type()))
+	}
+	for _, v := range argp.vars {
+		// the new argument is the last
+		if v.Trailing != 0 {
+			v.Trailing++
+		}
+	}
+	if !isCustom {
+		variable.Default = v.Interface()
+	}
+	variable.Description = description
+	argp.vars = append(argp.vars, variable)
+}
+
 func (argp *Argp) AddRest(dst any, name, description string) {
 	v := reflect.ValueOf(dst)
 	_, isCustom := dst.(ArgumentScanner)
@@ -268,8 +612,8 @@ func (argp *Argp) AddRest(dst any, name, description string) {
 	variable.Index = -1
 	if argp.findRest() != nil {
 		panic("rest option already exists")
-	} else if v.Kind() != reflect.Slice || v.Type().Elem().Kind() != reflect.String {
-		panic("rest option must be of type []string")
+	} else if v.Kind() != reflect.Slice || !isValidBaseType(v.Type().Elem()) {
+		panic("rest option must be a slice")
 	}
 	variable.Rest = true
 	if !isCustom {
@@ -279,226 +623,369 @@ func (argp *Argp) AddRest(dst any, name, description string) {
 	argp.vars = append(argp.vars, variable)
 }
 
-type optionHelp struct {
-	short, name, typ, desc string
+// AddRestN adds the rest arguments like `Argp.AddRest`, of which there must be between minCount and maxCount, where a maxCount of zero is unlimited.
+func (argp *Argp) AddRestN(dst any, name, description string, minCount, maxCount int) {
+	if minCount < 0 || maxCount < 0 {
+		panic("rest count must be non-negative")
+	} else if maxCount != 0 && maxCount < minCount {
+		panic("rest max count must not be smaller than min count")
+	}
+
+	argp.AddRest(dst, name, description)
+	rest := argp.findRest()
+	rest.Min = minCount
+	rest.Max = maxCount
+}
+
+// AddPassThrough adds a variable that collects the unknown options in order instead of returning ErrUnknownOption, e.g. to pass them on to another program. Only values attached with = are collected with their option.
+func (argp *Argp) AddPassThrough(dst *[]string) {
+	if argp.findPassThrough() != nil {
+		panic("pass-through option already exists")
+	}
+
+	v := reflect.ValueOf(dst).Elem()
+	variable := &argpVariable.Variable{}
+	variable.Value = v
+	variable.Index = -1
+	variable.PassThrough = true
+	variable.Default = v.Interface()
+	argp.vars = append(argp.vars, variable)
+}
+
+// Parse parses the command line arguments and runs the Run method of the selected command. It returns ErrShowHelp when the help should be printed, see `Argp.Main` for a helper that handles this and exits.
+func (argp *Argp) Parse() error {
+	return argp.ParseArgs(os.Args[1:])
 }
 
-func getOptionHelps(vs []*argpVariable.Variable) []optionHelp {
-	var helps []optionHelp
+// ParseArgs parses the given arguments like `Argp.Parse`, without the program name.
+func (argp *Argp) ParseArgs(args []string) error {
+	return argp.execute(context.Background(), args)
+}
 
-	for _, v := range vs {
-		var val, typ string
-		if custom, ok := v.Value.Interface().(ArgumentScanner); ok {
-			val, typ = custom.Help()
-		} else {
-			if v.Default != nil && !reflect.ValueOf(v.Default).IsZero() {
-				val = fmt.Sprint(v.Default)
-			}
-			typ = TypeName(v.Value.Type())
-		}
+// ParseContext parses the command line arguments like `Argp.Parse` and passes a context to the Run method of commands added with `NewContextCmd` or `Argp.AddContextCmd`. The context is cancelled when ctx is done or when one of the Signals is received, so that long-running commands can shut down cleanly. A second signal exits the program.
+func (argp *Argp) ParseContext(ctx context.Context) error {
+	ctx, stop := argp.notifyContext(ctx)
+	defer stop()
 
-		var short, name string
-		if v.Short != 0 {
-			short = string(v.Short)
+	return argp.execute(ctx, os.Args[1:])
+}
+
+// ExitCoder is an error that sets the exit code when returned from a Run method called by `Argp.Main`.
+type ExitCoder interface {
+	ExitCode() int
+}
+
+// Main parses the command line arguments, runs the selected command with a context like `Argp.ParseContext`, and exits the program with the exit code of `Argp.Execute`.
+func (argp *Argp) Main() {
+	ctx, stop := argp.notifyContext(context.Background())
+	code := argp.Execute(ctx, os.Args[1:])
+	stop()
+	os.Exit(code)
+}
+
+// Execute parses the given arguments and runs the selected command, and returns an exit code instead of an error. The help is printed to stdout with exit code 0 when requested, and to stderr with exit code 2 when a sub command is missing. Other parse errors are printed to stderr with exit code 2. Errors returned from Run are printed to stderr with the exit code of an ExitCoder error, or else 1.
+func (argp *Argp) Execute(ctx context.Context, args []string) int {
+	cmd, err := argp.selectCmd(args)
+	if errors.Is(err, argpErrors.ErrMissingCommand) {
+		if err := cmd.printHelp(cmd.stderr()); err != nil {
+			fmt.Fprintf(cmd.stderr(), "%s: %v\n", argp.Name, err)
 		}
-		name = v.Name
-		if val != "" {
-			if space := strings.IndexByte(val, ' '); space != -1 {
-				val = "'" + val + "'"
-			}
-			if name != "" {
-				name += "=" + val
-			} else {
-				short += "=" + val
-			}
+		return 2
+	} else if errors.Is(err, argpErrors.ErrShowHelp) {
+		if err := cmd.PrintHelp(); err != nil {
+			fmt.Fprintf(cmd.stderr(), "%s: %v\n", argp.Name, err)
+			return 1
 		}
-		helps = append(helps, optionHelp{
-			short: short,
-			name:  name,
-			typ:   typ,
-			desc:  v.Description,
-		})
+		return 0
+	} else if err != nil {
+		for _, line := range strings.Split(err.Error(), "\n") {
+			fmt.Fprintf(cmd.stderr(), "%s: %s\n", argp.Name, line)
+		}
+		return 2
+	} else if cmd.command() == nil {
+		return 0
+	}
 
+	if err := cmd.runWithHooks(ctx); err != nil {
+		fmt.Fprintf(cmd.stderr(), "%s: %v\n", argp.Name, err)
+		var exitCoder ExitCoder
+		if errors.As(err, &exitCoder) {
+			return exitCoder.ExitCode()
+		}
+		return 1
 	}
-	return helps
+	return 0
 }
 
-// PrintHelp prints the help overview. This is automatically called when unknown or bad options are passed, but you can call this explicitly in other cases.
-func (argp *Argp) PrintHelp() {
-	base := argp.name
-	parent := argp.parent
-	for parent != nil {
-		base = parent.name + " " + base
-		parent = parent.parent
+func (argp *Argp) execute(ctx context.Context, arguments []string) error {
+	cmd, err := argp.selectCmd(arguments)
+	if errors.Is(err, argpErrors.ErrShowHelp) || errors.Is(err, argpErrors.ErrUnexpectedInput) {
+		return err
+	} else if err != nil {
+		return motmedelErrors.New(fmt.Errorf("parse: %w", err), arguments)
+	} else if cmd.command() == nil {
+		return nil
 	}
 
-	var options []*argpVariable.Variable
-	var arguments []*argpVariable.Variable
-	for _, v := range argp.vars {
-		if v.IsArgument() {
-			arguments = append(arguments, v)
-		} else {
-			options = append(options, v)
-		}
+	if err := cmd.runWithHooks(ctx); err != nil {
+		return motmedelErrors.New(fmt.Errorf("cmd run: %w", err), cmd.command())
 	}
 
-	sort.Slice(options, sortOption(options))
-	sort.Slice(arguments, sortArgument(arguments))
+	return nil
+}
 
-	args := ""
-	if 0 < len(options) {
-		args += " [options]"
+// selectCmd parses the arguments and returns the selected command. The command is also returned with an error, so that its help can be printed.
+func (argp *Argp) selectCmd(arguments []string) (*Argp, error) {
+	if !argp.ResponseFiles {
+		cmd, errs := argp.parseCmd(arguments)
+		return cmd, joinErrors(errs)
 	}
-	if 0 < len(argp.cmds) {
-		fmt.Printf("Usage: %s%s [command] ...\n", base, args)
+
+	arguments, origins, err := expandResponseFiles(arguments)
+	if err != nil {
+		return argp, err
+	}
+
+	cmd, errs := argp.parseCmd(arguments)
+	for _, err := range errs {
+		setOrigin(err, origins)
 	}
-	if 0 < len(arguments) {
-		for _, v := range arguments {
-			if !v.Rest {
-				args += " " + v.Name
+	return cmd, joinErrors(errs)
+}
+
+// parseCmd parses the arguments after response files are expanded and returns the selected command and the errors in argument order.
+func (argp *Argp) parseCmd(arguments []string) (*Argp, []error) {
+	cmd, rest, restIndices, errs := argp.parseAt(arguments, 0, passedArgs{})
+	if len(errs) == 0 {
+		for a := cmd; a != nil; a = a.parent {
+			if a.help {
+				return cmd, []error{argpErrors.ErrShowHelp}
 			}
 		}
-		if rest := argp.findRest(); rest != nil {
-			args += " " + rest.Name + "..."
+
+		// a sub command without a Run method only groups other sub commands
+		if cmd != argp && cmd.command() == nil {
+			return cmd, []error{fmt.Errorf("%w: %w", argpErrors.ErrShowHelp, argpErrors.ErrMissingCommand)}
 		}
 	}
-	if 0 < len(arguments) || len(argp.cmds) == 0 {
-		fmt.Printf("Usage: %s%s\n", base, args)
-	}
 
-	if 0 < len(options) {
-		optionHelps := getOptionHelps(options)
+	collect := cmd.collectErrors()
+	if len(errs) == 0 || collect {
+		errs = append(errs, cmd.countErrors(len(arguments))...)
 
-		fmt.Printf("\nOptions:\n")
-		nMax := 0
-		for _, o := range optionHelps {
-			n := 0
-			if o.short != "" {
-				n += 4
-				if o.name != "" {
-					n += 4 + len(o.name)
-				}
-			} else if o.name != "" {
-				n += 8 + len(o.name)
-			}
-			if o.typ != "" {
-				n += 1 + len(o.typ)
-			}
-			n++ // whitespace before description
-			if nMax < n {
-				nMax = n
-			}
+		// the main command of `New` only sets options, and the caller handles the remaining arguments
+		if cmd.command() != nil && len(rest) != 0 {
+			errs = append(errs, unexpectedInput(rest, restIndices))
 		}
-		if 30 < nMax {
-			nMax = 30
-		} else if nMax < 10 {
-			nMax = 10
-		}
-		for _, o := range optionHelps {
-			n := 0
-			if o.short != "" {
-				fmt.Printf("  -%s, --%s", o.short, o.name)
-				n += 8 + len(o.name)
-			} else if o.name != "" {
-				fmt.Printf("      --%s", o.name)
-				n += 8 + len(o.name)
+	}
+
+	slices.SortStableFunc(errs, func(a, b error) int {
+		return cmp.Compare(errorIndex(a), errorIndex(b))
+	})
+	if !collect && 1 < len(errs) {
+		errs = errs[:1]
+	}
+	return cmd, errs
+}
+
+// countErrors returns errors for the options of the command and its parents, and the rest arguments of the command, whose number of values is out of range. The arguments end at index end.
+func (argp *Argp) countErrors(end int) []error {
+	var errs []error
+	for a := argp; a != nil; a = a.parent {
+		for _, v := range a.vars {
+			if v.Min == 0 && v.Max == 0 {
+				continue
+			} else if !v.IsOption() && (!v.Rest || a != argp) {
+				// the rest of a parent command isn't used when a sub command is selected
+				continue
 			}
-			if o.typ != "" {
-				fmt.Printf(" %s", o.typ)
-				n += 1 + len(o.typ)
+
+			name := v.Name
+			if v.IsOption() {
+				name = "--" + v.Name
 			}
-			if nMax <= n {
-				fmt.Printf("\n")
-				n = 0
+
+			var index int
+			count := len(v.Positions)
+			if 0 < v.Max && v.Max < count {
+				index = v.Positions[v.Max] // the first value too many
+			} else if count < v.Min {
+				index = end
+			} else {
+				continue
 			}
-			fmt.Printf("%s", strings.Repeat(" ", nMax-n))
-			fmt.Printf("%s\n", o.desc)
+
+			errs = append(errs, motmedelErrors.NewWithTrace(&argpErrors.ParseError{
+				Err:   argpErrors.ErrCount,
+				Name:  name,
+				Index: index,
+				Cause: fmt.Errorf("expected %s, got %d", countRange(v.Min, v.Max), count),
+			}))
 		}
 	}
+	return errs
+}
 
-	if 0 < len(argp.cmds) {
-		fmt.Printf("\nCommands:\n")
-		nMax := 0
-		var cmds []string
-		for cmd := range argp.cmds {
-			if nMax < 2+len(cmd) {
-				nMax = 2 + len(cmd)
-			}
-			cmds = append(cmds, cmd)
-		}
-		sort.Strings(cmds)
+// parseCount parses a min or max count, which is zero if empty.
+func parseCount(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
 
-		if 28 < nMax {
-			nMax = 28
-		} else if nMax < 10 {
-			nMax = 10
-		}
-		for _, cmd := range cmds {
-			sub := argp.cmds[cmd]
-			n := 2 + len(cmd)
-			fmt.Printf("  %s", cmd)
-			if nMax < n {
-				fmt.Printf("\n")
-				n = 0
-			}
-			fmt.Printf("%s  %s\n", strings.Repeat(" ", nMax-n), sub.Description)
-		}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	} else if n < 0 {
+		return 0, fmt.Errorf("negative count: %d", n)
+	}
+	return n, nil
+}
+
+// countRange returns a description of the number of values between minCount and maxCount, where a maxCount of zero is unlimited.
+func countRange(minCount, maxCount int) string {
+	if maxCount == 0 {
+		return fmt.Sprintf("at least %d", minCount)
+	} else if minCount == maxCount {
+		return fmt.Sprintf("%d", minCount)
+	} else if minCount == 0 {
+		return fmt.Sprintf("at most %d", maxCount)
+	}
+	return fmt.Sprintf("%d to %d", minCount, maxCount)
+}
+
+// unexpectedInput returns a ParseError for the remaining arguments of a command that doesn't take them.
+func unexpectedInput(rest []string, restIndices []int) error {
+	return motmedelErrors.NewWithTrace(&argpErrors.ParseError{
+		Err:   argpErrors.ErrUnexpectedInput,
+		Index: restIndices[0],
+		Token: rest[0],
+		Cause: errors.New(strings.Join(rest, " ")),
+	})
+}
+
+// runWithHooks runs the Before hooks from the root command down to this command, the Run method, and then the After hooks in reverse order. After hooks only run for the commands whose Before hooks succeeded.
+func (argp *Argp) runWithHooks(ctx context.Context) error {
+	var path []*Argp
+	for a := argp; a != nil; a = a.parent {
+		path = append([]*Argp{a}, path...)
 	}
 
-	if 0 < len(arguments) {
-		fmt.Printf("\nArguments:\n")
-		nMax := 0
-		for _, v := range arguments {
-			n := 2 + len(v.Name)
-			if nMax < n {
-				nMax = n
+	var after []func(context.Context, error) error
+	err := func() error {
+		for _, a := range path {
+			var before []func(context.Context) error
+			if b, ok := a.command().(Beforer); ok {
+				before = append(before, b.Before)
 			}
-		}
-		if 28 < nMax {
-			nMax = 28
-		} else if nMax < 10 {
-			nMax = 10
-		}
-		for _, v := range arguments {
-			n := 2 + len(v.Name)
-			fmt.Printf("  %s", v.Name)
-			if nMax < n {
-				fmt.Printf("\n")
-				n = 0
+			before = append(before, a.before...)
+			for _, hook := range before {
+				if err := hook(ctx); err != nil {
+					return err
+				}
+			}
+
+			if b, ok := a.command().(Afterer); ok {
+				after = append(after, b.After)
 			}
-			fmt.Printf("%s  %s\n", strings.Repeat(" ", nMax-n), v.Description)
+			after = append(after, a.after...)
 		}
+		return argp.run(ctx)
+	}()
+
+	for i := len(after) - 1; 0 <= i; i-- {
+		err = after[i](ctx, err)
 	}
+	return err
 }
 
-// Parse parses the command line arguments. When the main command was instantiated with `NewCmd`, this command will exit.
-func (argp *Argp) Parse() error {
-	arguments := os.Args[1:]
-	cmd, rest, err := argp.parse(arguments)
-	if err != nil {
-		return motmedelErrors.New(fmt.Errorf("parse: %w", err), arguments)
+// command returns the Cmd or ContextCmd of the command, or nil if it has none.
+func (argp *Argp) command() any {
+	if argp.contextCmd != nil {
+		return argp.contextCmd
+	} else if argp.Cmd != nil {
+		return argp.Cmd
+	}
+	return nil
+}
+
+// run calls the Run method of the command.
+func (argp *Argp) run(ctx context.Context) error {
+	if argp.contextCmd != nil {
+		return argp.contextCmd.Run(ctx)
+	} else if argp.Cmd != nil {
+		return argp.Cmd.Run()
 	}
+	return nil
+}
 
-	// TODO: What do these conditions mean?
-	if cmd.help || cmd != argp && cmd.Cmd == nil {
-		return argpErrors.ErrShowHelp
+// notifyContext returns a context that is cancelled on the first of the command's signals. A second signal exits the program with 128 plus the signal number.
+func (argp *Argp) notifyContext(parent context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(parent)
+
+	signals := argp.Signals
+	if signals == nil {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	if len(signals) == 0 {
+		return ctx, cancel
 	}
 
-	// TODO: What does this condition mean?
-	if cmd.Cmd == nil {
-		return nil
+	c := make(chan os.Signal, 2)
+	signal.Notify(c, signals...)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-c:
+			cancel()
+		case <-done:
+			return
+		}
+		select {
+		case sig := <-c:
+			code := 1
+			if s, ok := sig.(syscall.Signal); ok {
+				code = 128 + int(s)
+			}
+			os.Exit(code)
+		case <-done:
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(c)
+		close(done)
+		cancel()
 	}
+}
 
-	if len(rest) != 0 {
-		restString := strings.Join(rest, " ")
-		return motmedelErrors.NewWithTrace(fmt.Errorf("%w: %s", argpErrors.ErrUnexpectedInput, restString))
+// stdout returns the writer for regular output.
+func (argp *Argp) stdout() io.Writer {
+	for a := argp; a != nil; a = a.parent {
+		if a.Stdout != nil {
+			return a.Stdout
+		}
 	}
+	return os.Stdout
+}
 
-	if err := cmd.Cmd.Run(); err != nil {
-		return motmedelErrors.New(fmt.Errorf("cmd run: %w", err), cmd.Cmd)
+// stderr returns the writer for error output.
+func (argp *Argp) stderr() io.Writer {
+	for a := argp; a != nil; a = a.parent {
+		if a.Stderr != nil {
+			return a.Stderr
+		}
 	}
+	return os.Stderr
+}
 
-	return nil
+// lookupEnv looks up an environment variable.
+func (argp *Argp) lookupEnv(key string) (string, bool) {
+	for a := argp; a != nil; a = a.parent {
+		if a.LookupEnv != nil {
+			return a.LookupEnv(key)
+		}
+	}
+	return os.LookupEnv(key)
 }
 
 func (argp *Argp) findShort(short rune) *argpVariable.Variable {
@@ -528,6 +1015,253 @@ func (argp *Argp) findName(name string) *argpVariable.Variable {
 	return nil
 }
 
+// lookupShort returns the option with the given short name, including the persistent options of the parent commands.
+func (argp *Argp) lookupShort(short rune) *argpVariable.Variable {
+	if v := argp.findShort(short); v != nil {
+		return v
+	}
+	for _, v := range argp.persistentVars() {
+		if v.Short != 0 && v.Short == short {
+			return v
+		}
+	}
+	return nil
+}
+
+// lookupName returns the option with the given name, including the persistent options of the parent commands. When abbreviations are allowed, a unique prefix of an option name also matches, and an ambiguous prefix returns an error listing the candidates.
+func (argp *Argp) lookupName(name string) (*argpVariable.Variable, error) {
+	if v := argp.findName(name); v != nil || name == "" {
+		return v, nil
+	}
+
+	name = strings.ToLower(name)
+	if i := strings.IndexAny(name, ".["); i != -1 {
+		name = name[:i]
+	}
+
+	options := argp.options()
+	for _, v := range options {
+		if v.Name == name {
+			return v, nil
+		}
+	}
+	if !argp.allowAbbreviation() {
+		return nil, nil
+	}
+
+	var matches []*argpVariable.Variable
+	for _, v := range options {
+		if strings.HasPrefix(v.Name, name) {
+			matches = append(matches, v)
+		}
+	}
+	if len(matches) == 0 {
+		return nil, nil
+	} else if len(matches) == 1 {
+		return matches[0], nil
+	}
+
+	candidates := make([]string, 0, len(matches))
+	for _, v := range matches {
+		candidates = append(candidates, "--"+v.Name)
+	}
+	sort.Strings(candidates)
+	return nil, &argpErrors.SuggestionError{
+		Err:         argpErrors.ErrAmbiguousOption,
+		Name:        name,
+		Suggestions: candidates,
+	}
+}
+
+// lookupCmd returns the sub command with the given name, or nil if there is none. When abbreviations are allowed, a unique prefix of a command name also matches, and an ambiguous prefix returns an error listing the candidates.
+func (argp *Argp) lookupCmd(name string) (*Argp, error) {
+	name = strings.ToLower(name)
+	if sub, ok := argp.cmds[name]; ok || name == "" || !argp.allowAbbreviation() {
+		return sub, nil
+	}
+
+	var candidates []string
+	var matches []*Argp
+	for cmd, sub := range argp.cmds {
+		if strings.HasPrefix(cmd, name) {
+			candidates = append(candidates, cmd)
+			if !slices.Contains(matches, sub) {
+				matches = append(matches, sub)
+			}
+		}
+	}
+	if len(matches) == 0 {
+		return nil, nil
+	} else if len(matches) == 1 {
+		return matches[0], nil
+	}
+
+	sort.Strings(candidates)
+	return nil, &argpErrors.SuggestionError{
+		Err:         argpErrors.ErrAmbiguousCommand,
+		Name:        name,
+		Suggestions: candidates,
+	}
+}
+
+// options returns the command's options followed by the persistent options of the parent commands.
+func (argp *Argp) options() []*argpVariable.Variable {
+	var options []*argpVariable.Variable
+	for _, v := range argp.vars {
+		if v.IsOption() {
+			options = append(options, v)
+		}
+	}
+	return append(options, argp.persistentVars()...)
+}
+
+// persistentVars returns the persistent options of the parent commands that are not shadowed by an option of the command itself or a closer parent.
+func (argp *Argp) persistentVars() []*argpVariable.Variable {
+	var vars []*argpVariable.Variable
+	for parent := argp.parent; parent != nil; parent = parent.parent {
+		for _, v := range parent.vars {
+			if !v.Persistent {
+				continue
+			}
+
+			shadowed := false
+			for a := argp; a != parent && !shadowed; a = a.parent {
+				shadowed = a.findName(v.Name) != nil || v.Short != 0 && a.findShort(v.Short) != nil
+			}
+			for _, w := range vars {
+				shadowed = shadowed || w.Name == v.Name || v.Short != 0 && w.Short == v.Short
+			}
+			if !shadowed {
+				vars = append(vars, v)
+			}
+		}
+	}
+	return vars
+}
+
+// optionNames returns the long and short names of all options, prefixed with dashes.
+func (argp *Argp) optionNames() []string {
+	var names []string
+	for _, v := range argp.options() {
+		names = append(names, "--"+v.Name)
+		if v.Short != 0 {
+			names = append(names, "-"+string(v.Short))
+		}
+	}
+	return names
+}
+
+// cmdNames returns the names of all sub commands.
+func (argp *Argp) cmdNames() []string {
+	names := make([]string, 0, len(argp.cmds))
+	for cmd := range argp.cmds {
+		names = append(names, cmd)
+	}
+	return names
+}
+
+// strictCommands returns true if the command or any of its parents reports unknown sub commands.
+func (argp *Argp) strictCommands() bool {
+	for a := argp; a != nil; a = a.parent {
+		if a.StrictCommands {
+			return true
+		}
+	}
+	return false
+}
+
+// collectErrors returns true if the command or any of its parents collects all parse errors.
+func (argp *Argp) collectErrors() bool {
+	for a := argp; a != nil; a = a.parent {
+		if a.CollectErrors {
+			return true
+		}
+	}
+	return false
+}
+
+// stopAtPositional returns true if option parsing ends at the first positional argument.
+func (argp *Argp) stopAtPositional() bool {
+	if argp.StopAtPositional {
+		return true
+	}
+	for a := argp; a != nil; a = a.parent {
+		if a.PosixlyCorrect {
+			_, ok := argp.lookupEnv("POSIXLY_CORRECT")
+			return ok
+		}
+	}
+	return false
+}
+
+// allowAbbreviation returns true if the command or any of its parents allows abbreviations.
+func (argp *Argp) allowAbbreviation() bool {
+	for a := argp; a != nil; a = a.parent {
+		if a.AllowAbbreviation {
+			return true
+		}
+	}
+	return false
+}
+
+// structField is a field of a command struct, where the fields of embedded structs are flattened.
+type structField struct {
+	reflect.StructField
+	value  reflect.Value
+	prefix string // option name prefix of the embedded structs
+}
+
+// structFields returns the fields of the struct, with the fields of embedded structs in their place. Nil pointers to embedded structs are allocated. Unexported fields and fields tagged with `argp:"-"` are skipped.
+func (argp *Argp) structFields(v reflect.Value, prefix string) []structField {
+	var fields []structField
+	for j := range v.NumField() {
+		tfield := v.Type().Field(j)
+		vfield := v.Field(j)
+		if tfield.Tag.Get("argp") == "-" || !tfield.IsExported() && !isEmbeddedStruct(tfield) {
+			// state of the command that isn't set from the arguments
+			continue
+		} else if isEmbeddedStruct(tfield) && argp.findParentCmd(tfield.Type) == nil {
+			if vfield.Kind() == reflect.Ptr {
+				if !vfield.CanSet() {
+					// the fields of an unexported pointer can't be set
+					continue
+				} else if vfield.IsNil() {
+					vfield.Set(reflect.New(tfield.Type.Elem()))
+				}
+				vfield = vfield.Elem()
+			}
+			fields = append(fields, argp.structFields(vfield, prefix+tfield.Tag.Get("prefix"))...)
+			continue
+		}
+		fields = append(fields, structField{tfield, vfield, prefix})
+	}
+	return fields
+}
+
+// isEmbeddedStruct returns true if the field is an embedded struct, or pointer to struct, whose fields are options of the command.
+func isEmbeddedStruct(field reflect.StructField) bool {
+	if _, isCmd := field.Tag.Lookup("cmd"); !field.Anonymous || isCmd {
+		return false
+	}
+
+	t := field.Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	scannerType := reflect.TypeOf((*ArgumentScanner)(nil)).Elem()
+	return t.Kind() == reflect.Struct && !reflect.PointerTo(t).Implements(textUnmarshalerType) && !reflect.PointerTo(t).Implements(scannerType)
+}
+
+// findParentCmd returns the command of the closest parent whose type is t, or nil if there is none.
+func (argp *Argp) findParentCmd(t reflect.Type) any {
+	for parent := argp.parent; parent != nil; parent = parent.parent {
+		if cmd := parent.command(); cmd != nil && reflect.TypeOf(cmd) == t {
+			return cmd
+		}
+	}
+	return nil
+}
+
 func (argp *Argp) findIndex(index int) *argpVariable.Variable {
 	for _, v := range argp.vars {
 		if v.Index == index {
@@ -537,42 +1271,79 @@ func (argp *Argp) findIndex(index int) *argpVariable.Variable {
 	return nil
 }
 
-func (argp *Argp) findRest() *argpVariable.Variable {
+func (argp *Argp) findPassThrough() *argpVariable.Variable {
 	for _, v := range argp.vars {
-		if v.Rest {
+		if v.PassThrough {
 			return v
 		}
 	}
 	return nil
 }
 
-func (argp *Argp) parse(args []string) (*Argp, []string, error) {
-	// sub commands
-	if 0 < len(args) {
-		for cmd, sub := range argp.cmds {
-			if cmd == strings.ToLower(args[0]) {
-				return sub.parse(args[1:])
-			}
+func (argp *Argp) findTrailing(trailing int) *argpVariable.Variable {
+	for _, v := range argp.vars {
+		if v.Trailing == trailing {
+			return v
+		}
+	}
+	return nil
+}
+
+func (argp *Argp) findRest() *argpVariable.Variable {
+	for _, v := range argp.vars {
+		if v.Rest {
+			return v
 		}
 	}
+	return nil
+}
 
+// parseAt parses the arguments, of which the first has the given offset in the arguments passed to the main command, with the unknown options passed on by the parent command. It returns the selected command, the remaining arguments and their indices, and the errors in argument order. Without CollectErrors it stops at the first error.
+func (argp *Argp) parseAt(args []string, offset int, unknown passedArgs) (*Argp, []string, []int, []error) {
 	// set defaults
 	for _, v := range argp.vars {
+		v.Positions = nil
 		if v.Default != nil {
 			if ok := v.Set(v.Default); !ok {
-				return argp, nil, fmt.Errorf("default: expected type %v", v.Value.Type())
+				return argp, nil, nil, []error{fmt.Errorf("default: expected type %v", v.Value.Type())}
 			}
 		}
 	}
 
+	collect := argp.collectErrors()
+	var errs []error
+
+	// unknown options, of which those passed by the parent command go to the pass-through variable if there is one
+	passThrough := argp.findPassThrough()
+	var passed []string
+	if passThrough != nil {
+		passed, unknown = unknown.args, passedArgs{}
+	}
+
 	var rest []string
+	var restIndices []int
+	positional := false // sub commands are only selected before the first positional argument
+	pass := func(token string, index int) bool {
+		if passThrough != nil {
+			passed = append(passed, token)
+		} else if argp.PassUnknown {
+			unknown.args = append(unknown.args, token)
+			unknown.indices = append(unknown.indices, offset+index)
+		} else {
+			return false
+		}
+		return true
+	}
 	for i := 0; i < len(args); i++ {
 		arg := args[i]
 		if arg == "--" {
 			rest = append(rest, args[i+1:]...)
+			for j := i + 1; j < len(args); j++ {
+				restIndices = append(restIndices, offset+j)
+			}
 			break
 		}
-		if 1 < len(arg) && arg[0] == '-' {
+		if isOption(arg) && !argp.isNegativeNumber(arg, len(rest)) {
 			if 1 < len(arg) && arg[1] == '-' {
 				split := false
 				s := args[i+1:]
@@ -585,17 +1356,72 @@ func (argp *Argp) parse(args []string) (*Argp, []string, error) {
 					}
 				}
 
-				v := argp.findName(name)
-				if v == nil {
-					return argp, nil, motmedelErrors.NewWithTrace(
-						fmt.Errorf("%w: %s", argpErrors.ErrUnknownOption, name),
-					)
+				v, err := argp.lookupName(name)
+				if err != nil {
+					errs = append(errs, motmedelErrors.NewWithTrace(&argpErrors.ParseError{
+						Err:   argpErrors.ErrAmbiguousOption,
+						Name:  "--" + name,
+						Index: offset + i,
+						Token: arg,
+						Cause: err,
+					}))
+					if !collect {
+						return argp, nil, nil, errs
+					}
+					continue
+				} else if v == nil && pass(arg, i) {
+					continue
+				} else if v == nil {
+					errs = append(errs, motmedelErrors.NewWithTrace(&argpErrors.ParseError{
+						Err:   argpErrors.ErrUnknownOption,
+						Name:  "--" + name,
+						Index: offset + i,
+						Token: arg,
+						Cause: &argpErrors.SuggestionError{
+							Err:         argpErrors.ErrUnknownOption,
+							Name:        name,
+							Suggestions: suggest(name, argp.optionNames()),
+						},
+					}))
+					if !collect {
+						return argp, nil, nil, errs
+					}
+					continue
 				}
 
-				value := v.Value
-				n, err := scanVar(value, name, s)
+				v.Positions = append(v.Positions, offset+i)
+				if v.Optional {
+					value := v.Implicit
+					if idx := strings.IndexByte(arg, '='); idx != -1 {
+						value = arg[idx+1:]
+					} else if next, ok := nextBool(v, args[i+1:]); ok {
+						value = next
+						i++
+					}
+					if _, err := scanOption(v, name, []string{value}, true); err != nil {
+						errs = append(errs, scanError("--"+name, offset+i, arg, v.Value, err))
+						if !collect {
+							return argp, nil, nil, errs
+						}
+					} else {
+						v.IsSet = true
+					}
+					continue
+				}
+
+				n, err := scanOption(v, name, s, split)
 				if err != nil {
-					return argp, nil, motmedelErrors.New(fmt.Errorf("scan var: %w", err), value, name, s)
+					index := i
+					if !split && 0 < len(s) {
+						index++
+					}
+					index += n // the invalid value of an option with several arguments
+					errs = append(errs, scanError("--"+name, offset+index, args[index], v.Value, err))
+					if !collect {
+						return argp, nil, nil, errs
+					}
+					i = index // skip the invalid value
+					continue
 				} else {
 					i += n
 					if split {
@@ -608,13 +1434,51 @@ func (argp *Argp) parse(args []string) (*Argp, []string, error) {
 					name, n := utf8.DecodeRuneInString(arg[j:])
 					j += n
 
-					v := argp.findShort(name)
-					if v == nil {
-						return argp, nil, motmedelErrors.NewWithTrace(
-							fmt.Errorf("%w: %s", argpErrors.ErrUnknownOption, string(name)),
-							name,
-						)
+					v := argp.lookupShort(name)
+					if v == nil && pass("-"+arg[j-n:], i) {
+						break
+					} else if v == nil {
+						errs = append(errs, motmedelErrors.NewWithTrace(&argpErrors.ParseError{
+							Err:   argpErrors.ErrUnknownOption,
+							Name:  "-" + string(name),
+							Index: offset + i,
+							Token: arg,
+							Cause: &argpErrors.SuggestionError{
+								Err:         argpErrors.ErrUnknownOption,
+								Name:        string(name),
+								Suggestions: suggest(string(name), argp.optionNames()),
+							},
+						}))
+						if !collect {
+							return argp, nil, nil, errs
+						}
+						continue // the next short option of the form -abc
 					} else {
+						v.Positions = append(v.Positions, offset+i)
+						if v.Optional {
+							value := v.Implicit
+							hasValue := j < len(arg) && arg[j] == '='
+							if hasValue {
+								value = arg[j+1:]
+							} else if next, ok := nextBool(v, args[i+1:]); ok && j == len(arg) {
+								value = next
+								hasValue = true
+								i++
+							}
+							if _, err := scanOption(v, string(name), []string{value}, true); err != nil {
+								errs = append(errs, scanError("-"+string(name), offset+i, arg, v.Value, err))
+								if !collect {
+									return argp, nil, nil, errs
+								}
+								break
+							}
+							v.IsSet = true
+							if hasValue {
+								break
+							}
+							continue // can be of the form -abc
+						}
+
 						s := append([]string{arg[j:]}, args[i+1:]...)
 						hasEquals := j < len(arg) && arg[j] == '='
 						if hasEquals {
@@ -626,12 +1490,23 @@ func (argp *Argp) parse(args []string) (*Argp, []string, error) {
 						}
 
 						nameString := string(name)
-						value := v.Value
 
-						n, err := scanVar(value, nameString, s)
+						n, err := scanOption(v, nameString, s, hasEquals)
 						if err != nil {
-							return argp, nil, motmedelErrors.New(fmt.Errorf("scan var: %w", err), value, nameString, s)
-						} else if n == 0 {
+							index := i
+							if !valueGlued && 0 < len(s) {
+								index++
+							}
+							index += n // the invalid value of an option with several arguments
+							errs = append(errs, scanError("-"+nameString, offset+index, args[index], v.Value, err))
+							if !collect {
+								return argp, nil, nil, errs
+							}
+							i = index // skip the invalid value
+							break
+						}
+						v.IsSet = true
+						if n == 0 {
 							continue // can be of the form -abc
 						}
 						if valueGlued {
@@ -640,37 +1515,225 @@ func (argp *Argp) parse(args []string) (*Argp, []string, error) {
 						i += n
 						break
 					}
-					v.IsSet = true
 				}
 			}
 		} else if 0 < len(arg) {
+			if !positional && 0 < len(argp.cmds) {
+				// sub commands
+				sub, err := argp.lookupCmd(arg)
+				if err != nil {
+					errs = append(errs, motmedelErrors.NewWithTrace(&argpErrors.ParseError{
+						Err:   argpErrors.ErrAmbiguousCommand,
+						Name:  arg,
+						Index: offset + i,
+						Token: arg,
+						Cause: err,
+					}))
+					return argp, nil, nil, errs
+				} else if sub != nil {
+					if passThrough != nil {
+						passThrough.Set(passed)
+						passThrough.IsSet = 0 < len(passed)
+					}
+					// the unknown options passed before the sub command go to the sub command
+					cmd, rest, restIndices, subErrs := sub.parseAt(args[i+1:], offset+i+1, unknown)
+					return cmd, rest, restIndices, append(errs, subErrs...)
+				} else if argp.strictCommands() {
+					errs = append(errs, motmedelErrors.NewWithTrace(&argpErrors.ParseError{
+						Err:   argpErrors.ErrUnknownCommand,
+						Name:  arg,
+						Index: offset + i,
+						Token: arg,
+						Cause: &argpErrors.SuggestionError{
+							Err:         argpErrors.ErrUnknownCommand,
+							Name:        arg,
+							Suggestions: suggest(arg, argp.cmdNames()),
+						},
+					}))
+					return argp, nil, nil, errs
+				}
+			}
+			if argp.stopAtPositional() {
+				rest = append(rest, args[i:]...)
+				for j := i; j < len(args); j++ {
+					restIndices = append(restIndices, offset+j)
+				}
+				break
+			}
+			positional = true
 			rest = append(rest, arg)
+			restIndices = append(restIndices, offset+i)
 		}
 	}
 
 	// indexed arguments
 	index := 0
-	for _, arg := range rest {
+	for k, arg := range rest {
 		v := argp.findIndex(index)
 		if v == nil {
 			break
 		}
 		if _, err := scanVar(v.Value, "", []string{arg}); err != nil {
-			return argp, nil, fmt.Errorf("argument %d: %v", index, err)
+			errs = append(errs, scanError(v.Name, restIndices[k], arg, v.Value, err))
+			if !collect {
+				return argp, nil, nil, errs
+			}
+		} else {
+			v.IsSet = true
 		}
-		v.IsSet = true
 		index++
 	}
+	rest, restIndices = rest[index:], restIndices[index:]
+
+	// trailing arguments, of which the first are set if there are too few arguments
+	trailing := 0
+	for argp.findTrailing(trailing+1) != nil {
+		trailing++
+	}
+	n := min(trailing, len(rest))
+	for k := range n {
+		v := argp.findTrailing(trailing - k)
+		j := len(rest) - n + k
+		if _, err := scanVar(v.Value, "", []string{rest[j]}); err != nil {
+			errs = append(errs, scanError(v.Name, restIndices[j], rest[j], v.Value, err))
+			if !collect {
+				return argp, nil, nil, errs
+			}
+		} else {
+			v.IsSet = true
+		}
+	}
+	rest, restIndices = rest[:len(rest)-n], restIndices[:len(rest)-n]
+	rest, restIndices = mergeArgs(rest, restIndices, unknown.args, unknown.indices)
+
+	if passThrough != nil {
+		passThrough.Set(passed)
+		passThrough.IsSet = 0 < len(passed)
+	}
 
 	// rest arguments
-	v := argp.findRest()
-	rest = rest[index:]
-	if v != nil {
-		v.Set(rest)
-		rest = rest[:0]
+	if v := argp.findRest(); v != nil {
+		if v.Value.Kind() == reflect.Slice {
+			values := reflect.MakeSlice(v.Value.Type(), 0, len(rest))
+			for k, arg := range rest {
+				value := reflect.New(v.Value.Type().Elem()).Elem()
+				if _, err := scanValue(value, []string{arg}); err != nil {
+					errs = append(errs, scanError(v.Name, restIndices[k], arg, value, err))
+					if !collect {
+						return argp, nil, nil, errs
+					}
+					continue
+				}
+				values = reflect.Append(values, value)
+				v.Positions = append(v.Positions, restIndices[k])
+			}
+			v.Value.Set(values)
+		} else {
+			v.Set(rest)
+			v.Positions = restIndices
+		}
+		rest, restIndices = rest[:0], restIndices[:0]
 		v.IsSet = true
 	}
-	return argp, rest, nil
+	return argp, rest, restIndices, errs
+}
+
+// passedArgs are unknown options that are passed on to the remaining arguments, and their argument indices.
+type passedArgs struct {
+	args    []string
+	indices []int
+}
+
+// mergeArgs merges two lists of arguments and their indices in argument order.
+func mergeArgs(a []string, aIndices []int, b []string, bIndices []int) ([]string, []int) {
+	if len(b) == 0 {
+		return a, aIndices
+	}
+
+	args := make([]string, 0, len(a)+len(b))
+	indices := make([]int, 0, len(a)+len(b))
+	for 0 < len(a) || 0 < len(b) {
+		if len(b) == 0 || 0 < len(a) && aIndices[0] < bIndices[0] {
+			args, indices = append(args, a[0]), append(indices, aIndices[0])
+			a, aIndices = a[1:], aIndices[1:]
+		} else {
+			args, indices = append(args, b[0]), append(indices, bIndices[0])
+			b, bIndices = b[1:], bIndices[1:]
+		}
+	}
+	return args, indices
+}
+
+// errorIndex returns the argument index of a ParseError, or -1 for other errors.
+func errorIndex(err error) int {
+	var parseErr *argpErrors.ParseError
+	if errors.As(err, &parseErr) {
+		return parseErr.Index
+	}
+	return -1
+}
+
+// joinErrors returns nil for no errors, the error itself for a single error, or else the errors joined with errors.Join.
+func joinErrors(errs []error) error {
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	return errors.Join(errs...)
+}
+
+// scanError returns a ParseError for a value that could not be scanned into v.
+func scanError(name string, index int, token string, v reflect.Value, err error) error {
+	sentinel := argpErrors.ErrInvalidValue
+	if errors.Is(err, argpErrors.ErrMissingValue) {
+		sentinel = argpErrors.ErrMissingValue
+	}
+
+	typ := TypeName(v.Type())
+	if custom, ok := v.Interface().(ArgumentScanner); ok {
+		_, typ = custom.Help()
+	}
+
+	return motmedelErrors.NewWithTrace(&argpErrors.ParseError{
+		Err:   sentinel,
+		Name:  name,
+		Index: index,
+		Token: token,
+		Type:  typ,
+		Cause: err,
+	})
+}
+
+// scanOption parses the arguments of an option into its value, of which the first is attached to the option with = if attached is true. For an option with several arguments, the number of valid arguments is returned with an error.
+func scanOption(v *argpVariable.Variable, name string, arguments []string, attached bool) (int, error) {
+	if scanner, ok := v.Value.Interface().(attachedScanner); ok && attached {
+		n, err := scanner.scanAttached(name, arguments)
+		if err != nil {
+			return 0, motmedelErrors.New(fmt.Errorf("scanner scan attached: %w", err), scanner)
+		}
+
+		return n, nil
+	} else if v.Nargs == 0 {
+		return scanVar(v.Value, name, arguments)
+	} else if len(arguments) < v.Nargs {
+		return 0, motmedelErrors.NewWithTrace(fmt.Errorf("%w: expected %d values, got %d", argpErrors.ErrMissingValue, v.Nargs, len(arguments)))
+	}
+
+	// the values are scanned into a copy, so that the option is unchanged by an invalid value
+	value := reflect.New(v.Value.Type()).Elem()
+	if value.Kind() == reflect.Slice {
+		value.Set(reflect.MakeSlice(value.Type(), v.Nargs, v.Nargs))
+	}
+	for k := range v.Nargs {
+		elem := value.Index
+		if value.Kind() == reflect.Struct {
+			elem = value.Field
+		}
+		if _, err := scanValue(elem(k), arguments[k:k+1]); err != nil {
+			return k, fmt.Errorf("value %d: %w", k+1, err)
+		}
+	}
+	v.Value.Set(value)
+	return v.Nargs, nil
 }
 
 // scanVar parses a slice of strings into the given value.
@@ -684,12 +1747,7 @@ func scanVar(v reflect.Value, name string, arguments []string) (int, error) {
 		return n, nil
 	}
 
-	n, err := scanValue(v, arguments)
-	if err != nil && v.Kind() == reflect.Bool {
-		v.SetBool(true)
-		return 0, nil
-	}
-	return n, err
+	return scanValue(v, arguments)
 }
 
 func scanValue(v reflect.Value, arguments []string) (int, error) {
@@ -702,6 +1760,23 @@ func scanValue(v reflect.Value, arguments []string) (int, error) {
 		return 0, motmedelErrors.NewWithTrace(argpErrors.ErrMissingValue)
 	}
 
+	if v.Type() == durationType {
+		durationCandidate := arguments[0]
+		d, err := time.ParseDuration(durationCandidate)
+		if err != nil {
+			return 0, motmedelErrors.NewWithTrace(fmt.Errorf("time parse duration: %w", err), durationCandidate)
+		}
+
+		v.SetInt(int64(d))
+		return 1, nil
+	} else if v.CanAddr() && v.Addr().Type().Implements(textUnmarshalerType) {
+		textCandidate := arguments[0]
+		if err := v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(textCandidate)); err != nil {
+			return 0, motmedelErrors.NewWithTrace(fmt.Errorf("unmarshal text: %w", err), textCandidate)
+		}
+		return 1, nil
+	}
+
 	n := 0
 	switch kind := v.Kind(); kind {
 	case reflect.String:
@@ -815,6 +1890,56 @@ func scanValue(v reflect.Value, arguments []string) (int, error) {
 	return n, nil
 }
 
+// isOption returns true if the argument is a short or long option.
+func isOption(arg string) bool {
+	return 1 < len(arg) && arg[0] == '-'
+}
+
+// isNumber returns true if the argument is a decimal integer or floating-point number, e.g. 5, -5 or -.5.
+func isNumber(arg string) bool {
+	s := strings.TrimPrefix(arg, "-")
+	if s == "" || s[0] == '.' && (len(s) == 1 || s[1] < '0' || '9' < s[1]) {
+		return false
+	} else if s[0] != '.' && (s[0] < '0' || '9' < s[0]) {
+		return false
+	}
+	_, err := strconv.ParseFloat(arg, 64)
+	return err == nil
+}
+
+// isNegativeNumber returns true if the argument is a negative number and not a short option, i.e. the positional argument at the given position is numeric or there is no short option for the first digit.
+func (argp *Argp) isNegativeNumber(arg string, position int) bool {
+	return strings.HasPrefix(arg, "-") && isNumber(arg) && (argp.isNumericArg(position) || argp.lookupShort(rune(arg[1])) == nil)
+}
+
+// isNumericArg returns true if the positional argument at the given position, counting from zero, has a numeric type. After the indexed arguments, it is the rest or a trailing argument.
+func (argp *Argp) isNumericArg(position int) bool {
+	if v := argp.findIndex(position); v != nil {
+		return isNumericType(v.Value.Type())
+	} else if v := argp.findRest(); v != nil && v.Value.Kind() == reflect.Slice && isNumericType(v.Value.Type().Elem()) {
+		return true
+	}
+	for trailing := 1; ; trailing++ {
+		v := argp.findTrailing(trailing)
+		if v == nil {
+			return false
+		} else if isNumericType(v.Value.Type()) {
+			return true
+		}
+	}
+}
+
+// isNumericType returns true for integer and floating-point types, except time.Duration.
+func isNumericType(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return t != durationType
+	}
+	return false
+}
+
 // isValidName returns true if the short or long option name is valid.
 func isValidName(s string) bool {
 	for i, r := range s {
@@ -835,6 +1960,10 @@ func isValidType(t reflect.Type) bool {
 }
 
 func isValidBaseType(t reflect.Type) bool {
+	if t == durationType || reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return true
+	}
+
 	switch t.Kind() {
 	case reflect.String, reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
 		return true
@@ -853,10 +1982,38 @@ func isValidBaseType(t reflect.Type) bool {
 	return false
 }
 
+// isValidNargs returns true if the type can hold the values of an option with n arguments.
+func isValidNargs(t reflect.Type, n int) bool {
+	switch t.Kind() {
+	case reflect.Array:
+		return t.Len() == n && isValidBaseType(t.Elem())
+	case reflect.Slice:
+		return isValidBaseType(t.Elem())
+	case reflect.Struct:
+		if t.NumField() != n {
+			return false
+		}
+		for i := range t.NumField() {
+			if !t.Field(i).IsExported() || !isValidBaseType(t.Field(i).Type) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
 // TypeName returns the type's name.
 func TypeName(t reflect.Type) string {
 	k := t.Kind()
-	if k == reflect.Int || k == reflect.Int8 || k == reflect.Int16 || k == reflect.Int32 || k == reflect.Int64 {
+	if t == durationType {
+		return "duration"
+	} else if reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		if t.Name() == "" {
+			return "string"
+		}
+		return strings.ToLower(t.Name())
+	} else if k == reflect.Int || k == reflect.Int8 || k == reflect.Int16 || k == reflect.Int32 || k == reflect.Int64 {
 		return "int"
 	} else if k == reflect.Uint || k == reflect.Uint8 || k == reflect.Uint16 || k == reflect.Uint32 || k == reflect.Uint64 {
 		return "uint"
@@ -890,13 +2047,21 @@ func sortOption(vars []*argpVariable.Variable) func(int, int) bool {
 	}
 }
 
-// sortArgument sorts arguments by index and then rest.
+// sortArgument sorts arguments by index, then rest, and then the trailing arguments.
 func sortArgument(vars []*argpVariable.Variable) func(int, int) bool {
+	rank := func(v *argpVariable.Variable) int {
+		if v.Trailing != 0 {
+			return 2
+		} else if v.Rest {
+			return 1
+		}
+		return 0
+	}
 	return func(i, j int) bool {
-		if vars[i].Rest {
-			return false
-		} else if vars[j].Rest {
-			return true
+		if ri, rj := rank(vars[i]), rank(vars[j]); ri != rj {
+			return ri < rj
+		} else if vars[i].Trailing != vars[j].Trailing {
+			return vars[j].Trailing < vars[i].Trailing
 		}
 		return vars[i].Index < vars[j].Index
 	}
@@ -925,6 +2090,7 @@ func splitArguments(s string) []string {
 	i := 0
 	var esc bool
 	var quote rune
+	quoted := false // the argument has quotes, so it is kept when empty
 	arg := ""
 	var args []string
 	for j, r := range s {
@@ -936,9 +2102,10 @@ func splitArguments(s string) []string {
 			esc = true
 		} else if esc {
 			esc = false
-		} else if (quote == 0 || quote == r) && r == '\'' || r == '"' {
+		} else if (quote == 0 || quote == r) && (r == '\'' || r == '"') {
 			if quote == 0 {
 				quote = r
+				quoted = true
 			} else {
 				quote = 0
 			}
@@ -947,9 +2114,10 @@ func splitArguments(s string) []string {
 			}
 			i = j + 1
 		} else if quote == 0 && unicode.IsSpace(r) {
-			if i < j {
+			if i < j || arg != "" || quoted {
 				args = append(args, arg+s[i:j])
 				arg = ""
+				quoted = false
 			}
 			i = j + utf8.RuneLen(r)
 		}
@@ -1,18 +1,29 @@
 package argp
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	argpErrors "github.com/vphpersson/argp/pkg/errors"
+	"net/netip"
+	"os"
 	"strconv"
 	"strings"
+	"syscall"
 	"testing"
+	"time"
 )
 
 var diffOpts = []cmp.Option{cmpopts.EquateEmpty()}
 
+// parse parses the arguments and returns the selected command and the remaining arguments, without the checks after parsing in `Argp.parseCmd`.
+func (argp *Argp) parse(args []string) (*Argp, []string, error) {
+	cmd, rest, _, errs := argp.parseAt(args, 0, passedArgs{})
+	return cmd, rest, joinErrors(errs)
+}
+
 type STypesStruct struct {
 	Bool   bool
 	Struct struct {
@@ -387,6 +398,11 @@ func TestSplitArguments(t *testing.T) {
 		{"'foo'\"bar\"", []string{"foobar"}},
 		{"'foo\\'bar'", []string{"foo'bar"}},
 		{"foo ' bar '", []string{"foo", " bar "}},
+		{"'foo bar' baz", []string{"foo bar", "baz"}},
+		{"'he said \"hi\"' plain", []string{"he said \"hi\"", "plain"}},
+		{"\"it's\" plain", []string{"it's", "plain"}},
+		{"a '' b", []string{"a", "", "b"}},
+		{"a \"\" b ''", []string{"a", "", "b", ""}},
 	}
 
 	for _, testCase := range testCases {
@@ -507,3 +523,1467 @@ func ExampleArgumentScanner() {
 	fmt.Println(custom.Num, "/", custom.Div)
 	// Output: 1 / 2
 }
+
+func TestArgpAbbreviation(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		arguments []string
+		verbose   bool
+		version   bool
+		force     bool
+		cmd       string
+		error     error
+	}{
+		{[]string{"--verbose"}, true, false, false, "", nil},
+		{[]string{"--verb"}, true, false, false, "", nil},
+		{[]string{"--vers"}, false, true, false, "", nil},
+		{[]string{"--f"}, false, false, true, "", nil},
+		{[]string{"--ver"}, false, false, false, "", argpErrors.ErrAmbiguousOption},
+		{[]string{"dep"}, false, false, false, "deploy", nil},
+		{[]string{"de"}, false, false, false, "", argpErrors.ErrAmbiguousCommand},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(fmt.Sprintf("%v", testCase.arguments), func(t *testing.T) {
+			t.Parallel()
+
+			var verbose, version, force bool
+			argp := New("description")
+			argp.AllowAbbreviation = true
+			argp.AddOpt(&verbose, "", "verbose", "description")
+			argp.AddOpt(&version, "", "version", "description")
+			argp.AddOpt(&force, "", "force", "description")
+			argp.AddCmd(&SSub1{}, "deploy", "description")
+			argp.AddCmd(&SSub2{}, "describe", "description")
+
+			cmd, _, err := argp.parse(testCase.arguments)
+			if !errors.Is(err, testCase.error) {
+				t.Fatalf("error mismatch: expected %q, got %q", testCase.error, err)
+			}
+			if err != nil {
+				return
+			}
+
+			if verbose != testCase.verbose || version != testCase.version || force != testCase.force {
+				t.Errorf("mismatch: expected %v %v %v, got %v %v %v", testCase.verbose, testCase.version, testCase.force, verbose, version, force)
+			}
+			if testCase.cmd != "" && cmd.Name != testCase.cmd {
+				t.Errorf("expected command %v, got %v", testCase.cmd, cmd.Name)
+			}
+		})
+	}
+
+	var verbose bool
+	argp := New("description")
+	argp.AddOpt(&verbose, "", "verbose", "description")
+	if _, _, err := argp.parse([]string{"--verb"}); !errors.Is(err, argpErrors.ErrUnknownOption) {
+		t.Errorf("expected unknown option without abbreviations, got %v", err)
+	}
+}
+
+func TestArgpSuggestions(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		arguments   []string
+		error       error
+		suggestions []string
+	}{
+		{[]string{"--verbos"}, argpErrors.ErrUnknownOption, []string{"--verbose"}},
+		{[]string{"--vrebose"}, argpErrors.ErrUnknownOption, []string{"--verbose"}},
+		{[]string{"--verb"}, argpErrors.ErrUnknownOption, []string{"--verbose"}},
+		{[]string{"-V"}, argpErrors.ErrUnknownOption, []string{"-v"}},
+		{[]string{"--xyz"}, argpErrors.ErrUnknownOption, nil},
+		{[]string{"deplyo"}, argpErrors.ErrUnknownCommand, []string{"deploy"}},
+		{[]string{"lsit"}, argpErrors.ErrUnknownCommand, []string{"list"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(fmt.Sprintf("%v", testCase.arguments), func(t *testing.T) {
+			t.Parallel()
+
+			var verbose bool
+			argp := New("description")
+			argp.StrictCommands = true
+			argp.AddOpt(&verbose, "v", "verbose", "description")
+			argp.AddCmd(&SSub1{}, "deploy", "description")
+			argp.AddCmd(&SSub2{}, "list", "description")
+
+			_, _, err := argp.parse(testCase.arguments)
+			if !errors.Is(err, testCase.error) {
+				t.Fatalf("error mismatch: expected %q, got %q", testCase.error, err)
+			}
+
+			var suggestionErr *argpErrors.SuggestionError
+			if !errors.As(err, &suggestionErr) {
+				t.Fatalf("expected a suggestion error, got %T", err)
+			}
+			if diff := cmp.Diff(testCase.suggestions, suggestionErr.Suggestions, diffOpts...); diff != "" {
+				t.Errorf("mismatch (-expected +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+type contextKey struct{}
+
+type SContext struct {
+	N int `short:"n"`
+}
+
+func (s *SContext) Run(ctx context.Context) error {
+	if ctx.Value(contextKey{}) != "value" {
+		return fmt.Errorf("context not passed")
+	}
+	return nil
+}
+
+func TestArgpContextRunner(t *testing.T) {
+	t.Parallel()
+
+	s := SContext{}
+	argp := NewContextCmd(&s, "description")
+	sub := SContext{}
+	argp.AddContextCmd(&sub, "sub", "description")
+
+	ctx := context.WithValue(context.Background(), contextKey{}, "value")
+	if err := argp.execute(ctx, []string{"-n", "3"}); err != nil {
+		t.Fatalf("argp execute: %v", err)
+	}
+	if expected := 3; s.N != expected {
+		t.Errorf("expected %v, got %v", expected, s.N)
+	}
+	if err := argp.execute(ctx, []string{"sub", "-n", "4"}); err != nil {
+		t.Fatalf("argp execute: %v", err)
+	}
+	if expected := 4; sub.N != expected {
+		t.Errorf("expected %v, got %v", expected, sub.N)
+	}
+
+	parent, cancel := context.WithCancel(context.Background())
+	notifyCtx, stop := argp.notifyContext(parent)
+	defer stop()
+	cancel()
+	<-notifyCtx.Done()
+}
+
+func TestArgpContextSignal(t *testing.T) {
+	t.Parallel()
+
+	argp := New("description")
+	argp.Signals = []os.Signal{syscall.SIGUSR1}
+
+	ctx, stop := argp.notifyContext(context.Background())
+	defer stop()
+	if err := ctx.Err(); err != nil {
+		t.Fatalf("context cancelled before the signal: %v", err)
+	}
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("context not cancelled on the signal")
+	}
+}
+
+func TestArgpHooks(t *testing.T) {
+	t.Parallel()
+
+	s := &SHooks{}
+	argp := New("description")
+	argp.AddBefore(func(_ context.Context) error {
+		s.calls = append(s.calls, "before root")
+		return nil
+	})
+	argp.AddAfter(func(_ context.Context, err error) error {
+		s.calls = append(s.calls, fmt.Sprintf("after root: %v", err))
+		return err
+	})
+	group := argp.AddCmd(nil, "group", "description")
+	group.AddBefore(func(_ context.Context) error {
+		s.calls = append(s.calls, "before group")
+		return nil
+	})
+	group.AddAfter(func(_ context.Context, err error) error {
+		s.calls = append(s.calls, fmt.Sprintf("after group: %v", err))
+		return fmt.Errorf("group: %w", err)
+	})
+	group.AddCmd(s, "sub", "description")
+
+	err := argp.execute(context.Background(), []string{"group", "sub"})
+	if expected := "cmd run: group: run error"; err == nil || err.Error() != expected {
+		t.Errorf("error mismatch: expected %q, got %q", expected, err)
+	}
+
+	expected := []string{
+		"before root",
+		"before group",
+		"before sub",
+		"run",
+		"after sub: run error",
+		"after group: run error",
+		"after root: group: run error",
+	}
+	if diff := cmp.Diff(expected, s.calls, diffOpts...); diff != "" {
+		t.Errorf("mismatch (-expected +got):\n%s", diff)
+	}
+}
+
+type SHooks struct {
+	calls []string
+}
+
+func (s *SHooks) Before(_ context.Context) error {
+	s.calls = append(s.calls, "before sub")
+	return nil
+}
+
+func (s *SHooks) Run() error {
+	s.calls = append(s.calls, "run")
+	return errors.New("run error")
+}
+
+func (s *SHooks) After(_ context.Context, err error) error {
+	s.calls = append(s.calls, fmt.Sprintf("after sub: %v", err))
+	return err
+}
+
+type SPersistentRoot struct {
+	Verbose bool   `short:"v" persistent:"true"`
+	Config  string `persistent:"true"`
+	Local   bool
+}
+
+func (_ *SPersistentRoot) Run() error {
+	return nil
+}
+
+type SPersistentSub struct {
+	Root *SPersistentRoot
+	N    int `short:"n"`
+}
+
+func (s *SPersistentSub) Run() error {
+	if s.Root == nil || !s.Root.Verbose {
+		return fmt.Errorf("persistent option not readable from sub command")
+	}
+	return nil
+}
+
+func TestArgpPersistent(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		arguments []string
+		root      SPersistentRoot
+		n         int
+		error     error
+	}{
+		{[]string{"--verbose", "sub"}, SPersistentRoot{Verbose: true}, 0, nil},
+		{[]string{"sub", "--verbose"}, SPersistentRoot{Verbose: true}, 0, nil},
+		{[]string{"-v", "sub", "-n", "2"}, SPersistentRoot{Verbose: true}, 2, nil},
+		{[]string{"--config", "file", "sub", "-vn2"}, SPersistentRoot{Verbose: true, Config: "file"}, 2, nil},
+		{[]string{"--local", "sub", "--verbose"}, SPersistentRoot{Verbose: true, Local: true}, 0, nil},
+		{[]string{"sub", "--local"}, SPersistentRoot{}, 0, argpErrors.ErrUnknownOption},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(fmt.Sprintf("%v", testCase.arguments), func(t *testing.T) {
+			t.Parallel()
+
+			root := SPersistentRoot{}
+			sub := SPersistentSub{}
+			argp := NewCmd(&root, "description")
+			argp.AddCmd(&sub, "sub", "description")
+
+			err := argp.execute(context.Background(), testCase.arguments)
+			if !errors.Is(err, testCase.error) {
+				t.Fatalf("error mismatch: expected %q, got %q", testCase.error, err)
+			}
+			if err != nil {
+				return
+			}
+
+			if diff := cmp.Diff(testCase.root, root, diffOpts...); diff != "" {
+				t.Errorf("mismatch (-expected +got):\n%s", diff)
+			}
+			if sub.Root != &root {
+				t.Errorf("expected the parent command to be set")
+			}
+			if sub.N != testCase.n {
+				t.Errorf("expected %v, got %v", testCase.n, sub.N)
+			}
+		})
+	}
+}
+
+func TestArgpAddPersistentOpt(t *testing.T) {
+	t.Parallel()
+
+	var verbose bool
+	sub1 := SSub1{}
+	argp := New("description")
+	argp.AddPersistentOpt(&verbose, "v", "verbose", "description")
+	argp.AddCmd(&sub1, "one", "description")
+
+	cmd, _, err := argp.parse([]string{"one", "-vb", "2"})
+	if err != nil {
+		t.Fatalf("argp parse: %v", err)
+	}
+	if cmd.Name != "one" {
+		t.Errorf("expected command one, got %v", cmd.Name)
+	}
+	if !verbose {
+		t.Errorf("expected verbose to be set")
+	}
+	if expected := 2; sub1.B != expected {
+		t.Errorf("expected %v, got %v", expected, sub1.B)
+	}
+}
+
+type SNestedRoot struct {
+	Verbose bool           `short:"v" persistent:"true"`
+	Deploy  *SNestedDeploy `cmd:"deploy" desc:"Deploy the service" alias:"d,dep"`
+	Status  *SNestedStatus `cmd:"" desc:"Show the status"`
+}
+
+func (_ *SNestedRoot) Run() error {
+	return nil
+}
+
+type SNestedDeploy struct {
+	Root   *SNestedRoot
+	Target string         `index:"0"`
+	Cancel *SNestedStatus `cmd:"cancel"`
+}
+
+func (_ *SNestedDeploy) Run() error {
+	return nil
+}
+
+type SNestedStatus struct {
+	Root *SNestedRoot
+	All  bool `short:"a"`
+}
+
+func (_ *SNestedStatus) Run() error {
+	return nil
+}
+
+func TestArgpNestedCmd(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		arguments []string
+		cmd       string
+	}{
+		{[]string{"deploy", "prod"}, "deploy"},
+		{[]string{"d", "prod"}, "deploy"},
+		{[]string{"-v", "dep", "prod"}, "deploy"},
+		{[]string{"status", "-a"}, "status"},
+		{[]string{"deploy", "cancel", "-a"}, "cancel"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(fmt.Sprintf("%v", testCase.arguments), func(t *testing.T) {
+			t.Parallel()
+
+			root := SNestedRoot{}
+			argp := NewCmd(&root, "description")
+
+			cmd, rest, err := argp.parse(testCase.arguments)
+			if err != nil {
+				t.Fatalf("argp parse: %v", err)
+			}
+			if cmd.Name != testCase.cmd {
+				t.Errorf("expected command %v, got %v", testCase.cmd, cmd.Name)
+			}
+			if len(rest) != 0 {
+				t.Errorf("non-empty rest: %v", rest)
+			}
+			if root.Deploy == nil || root.Status == nil || root.Deploy.Cancel == nil {
+				t.Fatalf("expected sub commands to be allocated")
+			}
+			if root.Deploy.Root != &root || root.Status.Root != &root || root.Deploy.Cancel.Root != &root {
+				t.Errorf("expected the root command to be reachable from sub commands")
+			}
+		})
+	}
+}
+
+func TestArgpParseArgs(t *testing.T) {
+	t.Parallel()
+
+	sOptions := SOptions{}
+	argp := NewCmd(&sOptions, "description")
+	if err := argp.ParseArgs([]string{"-f", "val"}); err != nil {
+		t.Fatalf("argp parse args: %v", err)
+	}
+	if expected := "val"; sOptions.Foo != expected {
+		t.Errorf("expected %v, got %v", expected, sOptions.Foo)
+	}
+
+	var stdout strings.Builder
+	argp.Name = "prog"
+	argp.Stdout = &stdout
+	sub := argp.AddCmd(&SSub1{}, "sub", "description")
+	if err := argp.ParseArgs([]string{"sub", "--help"}); !errors.Is(err, argpErrors.ErrShowHelp) {
+		t.Fatalf("error mismatch: expected %q, got %q", argpErrors.ErrShowHelp, err)
+	}
+	sub.PrintHelp()
+	if expected := "Usage: prog sub [options]\n"; !strings.HasPrefix(stdout.String(), expected) {
+		t.Errorf("expected help starting with %q, got %q", expected, stdout.String())
+	}
+}
+
+type exitError struct {
+	code int
+}
+
+func (e exitError) Error() string {
+	return fmt.Sprintf("exit %d", e.code)
+}
+
+func (e exitError) ExitCode() int {
+	return e.code
+}
+
+type SExit struct {
+	Code int
+}
+
+func (s *SExit) Run() error {
+	if s.Code == 0 {
+		return nil
+	} else if s.Code == 1 {
+		return errors.New("failed")
+	}
+	return exitError{s.Code}
+}
+
+func TestArgpExecute(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		arguments []string
+		code      int
+		stdout    string
+		stderr    string
+	}{
+		{[]string{"run"}, 0, "", ""},
+		{[]string{"run", "--help"}, 0, "Usage: prog run [options]\n", ""},
+		{[]string{"--help"}, 0, "Usage: prog [options] [command] ...\n", ""},
+		{[]string{"group"}, 2, "", "Usage: prog group [options] [command] ...\n"},
+		{[]string{"run", "--bad"}, 2, "", "prog: unknown option: bad\n"},
+		{[]string{"run", "extra"}, 2, "", "prog: unexpected input: extra\n"},
+		{[]string{"run", "--code", "1"}, 1, "", "prog: failed\n"},
+		{[]string{"run", "--code", "3"}, 3, "", "prog: exit 3\n"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(fmt.Sprintf("%v", testCase.arguments), func(t *testing.T) {
+			t.Parallel()
+
+			var stdout, stderr strings.Builder
+			argp := New("")
+			argp.Name = "prog"
+			argp.Stdout = &stdout
+			argp.Stderr = &stderr
+			argp.AddCmd(&SExit{}, "run", "")
+			argp.AddCmd(nil, "group", "").AddCmd(&SExit{}, "sub", "")
+
+			if code := argp.Execute(context.Background(), testCase.arguments); code != testCase.code {
+				t.Errorf("expected exit code %v, got %v", testCase.code, code)
+			}
+			if got := stdout.String(); !strings.HasPrefix(got, testCase.stdout) || testCase.stdout == "" && got != "" {
+				t.Errorf("expected stdout starting with %q, got %q", testCase.stdout, got)
+			}
+			if got := stderr.String(); !strings.HasPrefix(got, testCase.stderr) || testCase.stderr == "" && got != "" {
+				t.Errorf("expected stderr starting with %q, got %q", testCase.stderr, got)
+			}
+		})
+	}
+}
+
+func TestArgpParseError(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		arguments []string
+		error     error
+		expected  argpErrors.ParseError
+	}{
+		{[]string{"--int", "string"}, strconv.ErrSyntax, argpErrors.ParseError{Err: argpErrors.ErrInvalidValue, Name: "--int", Index: 1, Token: "string", Type: "int"}},
+		{[]string{"--int=string"}, strconv.ErrSyntax, argpErrors.ParseError{Err: argpErrors.ErrInvalidValue, Name: "--int", Index: 0, Token: "--int=string", Type: "int"}},
+		{[]string{"--string", "x", "--int"}, argpErrors.ErrMissingValue, argpErrors.ParseError{Err: argpErrors.ErrMissingValue, Name: "--int", Index: 2, Token: "--int", Type: "int"}},
+		{[]string{"--float64", "1", "-x"}, argpErrors.ErrUnknownOption, argpErrors.ParseError{Err: argpErrors.ErrUnknownOption, Name: "-x", Index: 2, Token: "-x"}},
+		{[]string{"--bogus=1"}, argpErrors.ErrUnknownOption, argpErrors.ParseError{Err: argpErrors.ErrUnknownOption, Name: "--bogus", Index: 0, Token: "--bogus=1"}},
+		{[]string{"--bool", "a", "b"}, argpErrors.ErrUnexpectedInput, argpErrors.ParseError{Err: argpErrors.ErrUnexpectedInput, Index: 1, Token: "a"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(fmt.Sprintf("%v", testCase.arguments), func(t *testing.T) {
+			t.Parallel()
+
+			s := STypes{}
+			argp := NewCmd(&s, "description")
+
+			_, err := argp.selectCmd(testCase.arguments)
+			if !errors.Is(err, testCase.error) {
+				t.Errorf("error mismatch: expected %q, got %q", testCase.error, err)
+			}
+
+			var parseErr *argpErrors.ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("expected a ParseError, got %q", err)
+			}
+			if diff := cmp.Diff(testCase.expected, *parseErr, cmpopts.IgnoreFields(argpErrors.ParseError{}, "Cause"), cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("parse error mismatch (-expected +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestArgpParseErrorSubCommand(t *testing.T) {
+	t.Parallel()
+
+	argp := New("description")
+	argp.AddCmd(nil, "group", "description").AddCmd(&SSub1{}, "sub", "description")
+
+	_, err := argp.selectCmd([]string{"group", "sub", "-b", "x"})
+
+	var parseErr *argpErrors.ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("expected a ParseError, got %q", err)
+	}
+	if parseErr.Index != 3 || parseErr.Token != "x" || parseErr.Name != "-b" {
+		t.Errorf("expected -b at index 3 with token x, got %v at index %v with token %v", parseErr.Name, parseErr.Index, parseErr.Token)
+	}
+	if expected := "-b: invalid value (expected int)"; !strings.HasPrefix(parseErr.Error(), expected) {
+		t.Errorf("expected message starting with %q, got %q", expected, parseErr.Error())
+	}
+}
+
+func TestArgpCollectErrors(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		arguments []string
+		errors    []error
+		indices   []int
+	}{
+		{[]string{"--int", "x"}, []error{strconv.ErrSyntax}, []int{1}},
+		{[]string{"--int", "x", "--bogus", "--float64=.", "-x"}, []error{argpErrors.ErrInvalidValue, argpErrors.ErrUnknownOption, strconv.ErrSyntax, argpErrors.ErrUnknownOption}, []int{1, 2, 3, 4}},
+		{[]string{"--bool", "y", "--int"}, []error{argpErrors.ErrUnexpectedInput, argpErrors.ErrMissingValue}, []int{1, 2}},
+		{[]string{"--bogus", "extra"}, []error{argpErrors.ErrUnknownOption, argpErrors.ErrUnexpectedInput}, []int{0, 1}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(fmt.Sprintf("%v", testCase.arguments), func(t *testing.T) {
+			t.Parallel()
+
+			s := STypes{}
+			argp := NewCmd(&s, "description")
+			argp.CollectErrors = true
+
+			_, err := argp.selectCmd(testCase.arguments)
+			for _, expected := range testCase.errors {
+				if !errors.Is(err, expected) {
+					t.Errorf("error mismatch: expected %q, got %q", expected, err)
+				}
+			}
+
+			var indices []int
+			if joined, ok := err.(interface{ Unwrap() []error }); ok && 1 < len(testCase.indices) {
+				for _, err := range joined.Unwrap() {
+					var parseErr *argpErrors.ParseError
+					if errors.As(err, &parseErr) {
+						indices = append(indices, parseErr.Index)
+					}
+				}
+			} else {
+				var parseErr *argpErrors.ParseError
+				if errors.As(err, &parseErr) {
+					indices = append(indices, parseErr.Index)
+				}
+			}
+			if diff := cmp.Diff(testCase.indices, indices); diff != "" {
+				t.Errorf("indices mismatch (-expected +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestArgpCollectErrorsSubCommand(t *testing.T) {
+	t.Parallel()
+
+	var stderr strings.Builder
+	argp := New("description")
+	argp.Name = "prog"
+	argp.Stderr = &stderr
+	argp.CollectErrors = true
+	argp.AddCmd(&SSub1{}, "sub", "description")
+
+	if code := argp.Execute(context.Background(), []string{"-x", "sub", "-b", "y", "-z"}); code != 2 {
+		t.Errorf("expected exit code 2, got %v", code)
+	}
+
+	expected := "prog: unknown option: x\nprog: -b: invalid value (expected int): "
+	if got := stderr.String(); !strings.HasPrefix(got, expected) || !strings.HasSuffix(got, "prog: unknown option: z\n") {
+		t.Errorf("expected stderr starting with %q and ending with the unknown option z, got %q", expected, got)
+	}
+}
+
+type SExec struct {
+	Program string   `index:"0"`
+	Args    []string `index:"*"`
+}
+
+func (_ *SExec) Run() error {
+	return nil
+}
+
+func TestArgpStopAtPositional(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		arguments []string
+		env       bool
+		verbose   bool
+		args      []string
+	}{
+		{[]string{"exec", "ls", "-la"}, false, false, []string{"-la"}},
+		{[]string{"exec", "-v", "ls", "-v", "--", "x"}, false, true, []string{"-v", "--", "x"}},
+		{[]string{"-v", "exec", "ls", "-la", "-v"}, false, true, []string{"-la", "-v"}},
+		{[]string{"posix", "ls", "-v", "a"}, false, true, []string{"a"}},
+		{[]string{"posix", "ls", "-v", "a"}, true, false, []string{"-v", "a"}},
+		{[]string{"posix", "-v", "ls", "a"}, true, true, []string{"a"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(fmt.Sprintf("%v %v", testCase.arguments, testCase.env), func(t *testing.T) {
+			t.Parallel()
+
+			verbose := false
+			argp := New("description")
+			argp.AddPersistentOpt(&verbose, "v", "verbose", "description")
+			argp.PosixlyCorrect = true
+			argp.LookupEnv = func(key string) (string, bool) {
+				return "", key == "POSIXLY_CORRECT" && testCase.env
+			}
+			argp.AddCmd(&SExec{}, "exec", "description").StopAtPositional = true
+			argp.AddCmd(&SExec{}, "posix", "description")
+
+			cmd, err := argp.selectCmd(testCase.arguments)
+			if err != nil {
+				t.Fatalf("argp parse: %v", err)
+			}
+
+			s := cmd.Cmd.(*SExec)
+			if verbose != testCase.verbose || s.Program != "ls" {
+				t.Errorf("expected verbose %v and program ls, got %v and %v", testCase.verbose, verbose, s.Program)
+			}
+			if diff := cmp.Diff(testCase.args, s.Args, diffOpts...); diff != "" {
+				t.Errorf("mismatch (-expected +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+type SPassThrough struct {
+	Verbose bool     `short:"v"`
+	Forward []string `passthrough:"true"`
+	Args    []string `index:"*"`
+}
+
+func (_ *SPassThrough) Run() error {
+	return nil
+}
+
+func TestArgpPassThrough(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		arguments []string
+		verbose   bool
+		forward   []string
+		args      []string
+	}{
+		{[]string{"a", "b"}, false, nil, []string{"a", "b"}},
+		{[]string{"--color=never", "-v", "a", "--depth", "2"}, true, []string{"--color=never", "--depth"}, []string{"a", "2"}},
+		{[]string{"-vxz", "-x", "--", "--y"}, true, []string{"-xz", "-x"}, []string{"--y"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(fmt.Sprintf("%v", testCase.arguments), func(t *testing.T) {
+			t.Parallel()
+
+			s := SPassThrough{}
+			argp := NewCmd(&s, "description")
+
+			if _, err := argp.selectCmd(testCase.arguments); err != nil {
+				t.Fatalf("argp parse: %v", err)
+			}
+
+			if s.Verbose != testCase.verbose {
+				t.Errorf("expected verbose %v, got %v", testCase.verbose, s.Verbose)
+			}
+			if diff := cmp.Diff(testCase.forward, s.Forward, diffOpts...); diff != "" {
+				t.Errorf("forward mismatch (-expected +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(testCase.args, s.Args, diffOpts...); diff != "" {
+				t.Errorf("args mismatch (-expected +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestArgpPassUnknown(t *testing.T) {
+	t.Parallel()
+
+	verbose := false
+	argp := New("description")
+	argp.PassUnknown = true
+	argp.AddOpt(&verbose, "v", "verbose", "description")
+
+	_, rest, err := argp.parse([]string{"a", "--color=auto", "-v", "-Wall", "b"})
+	if err != nil {
+		t.Fatalf("argp parse: %v", err)
+	}
+
+	expected := []string{"a", "--color=auto", "-Wall", "b"}
+	if diff := cmp.Diff(expected, rest, diffOpts...); diff != "" {
+		t.Errorf("mismatch (-expected +got):\n%s", diff)
+	} else if !verbose {
+		t.Errorf("expected verbose to be set")
+	}
+
+	sub := argp.AddCmd(nil, "sub", "description")
+	cmd, rest, err := argp.parse([]string{"--color=auto", "sub", "x"})
+	if err != nil {
+		t.Fatalf("argp parse: %v", err)
+	} else if cmd != sub {
+		t.Errorf("expected the sub command to be selected")
+	} else if diff := cmp.Diff([]string{"--color=auto", "x"}, rest, diffOpts...); diff != "" {
+		t.Errorf("mismatch (-expected +got):\n%s", diff)
+	}
+
+	cmd, rest, err = argp.parse([]string{"a", "sub"})
+	if err != nil {
+		t.Fatalf("argp parse: %v", err)
+	} else if cmd != argp {
+		t.Errorf("expected the main command to be selected after a positional argument")
+	} else if diff := cmp.Diff([]string{"a", "sub"}, rest, diffOpts...); diff != "" {
+		t.Errorf("mismatch (-expected +got):\n%s", diff)
+	}
+
+	var forward []string
+	argp = New("description")
+	argp.AddPassThrough(&forward)
+	if _, _, err := argp.parse([]string{"--bogus", "-b"}); err != nil {
+		t.Fatalf("argp parse: %v", err)
+	} else if diff := cmp.Diff([]string{"--bogus", "-b"}, forward, diffOpts...); diff != "" {
+		t.Errorf("mismatch (-expected +got):\n%s", diff)
+	}
+
+	forward = nil
+	sub = argp.AddCmd(nil, "sub", "description")
+	if cmd, _, err := argp.parse([]string{"--bogus", "sub"}); err != nil {
+		t.Fatalf("argp parse: %v", err)
+	} else if cmd != sub {
+		t.Errorf("expected the sub command to be selected")
+	} else if diff := cmp.Diff([]string{"--bogus"}, forward, diffOpts...); diff != "" {
+		t.Errorf("mismatch (-expected +got):\n%s", diff)
+	}
+}
+
+type SPassUnknown struct {
+	Verbose bool     `short:"v"`
+	File    string   `index:"0"`
+	Rest    []string `index:"*"`
+}
+
+func (_ *SPassUnknown) Run() error {
+	return nil
+}
+
+type SPassThroughSub struct {
+	Forward []string `passthrough:"true"`
+}
+
+func (_ *SPassThroughSub) Run() error {
+	return nil
+}
+
+func TestArgpPassUnknownArgs(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		arguments []string
+		cmd       string
+		expected  SPassUnknown
+		forward   []string
+	}{
+		{[]string{"--foo=1", "file.txt", "x"}, "", SPassUnknown{File: "file.txt", Rest: []string{"--foo=1", "x"}}, nil},
+		{[]string{"a", "-W", "-v", "b", "--foo"}, "", SPassUnknown{Verbose: true, File: "a", Rest: []string{"-W", "b", "--foo"}}, nil},
+		{[]string{"--x=1", "run", "a", "--y", "b"}, "run", SPassUnknown{File: "a", Rest: []string{"--x=1", "--y", "b"}}, nil},
+		{[]string{"--x=1", "forward", "--y"}, "forward", SPassUnknown{}, []string{"--x=1", "--y"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(fmt.Sprintf("%v", testCase.arguments), func(t *testing.T) {
+			t.Parallel()
+
+			s := SPassUnknown{}
+			argp := NewCmd(&s, "description")
+			argp.PassUnknown = true
+			sub := SPassUnknown{}
+			run := argp.AddCmd(&sub, "run", "description")
+			run.PassUnknown = true
+			forward := SPassThroughSub{}
+			argp.AddCmd(&forward, "forward", "description")
+
+			cmd, err := argp.selectCmd(testCase.arguments)
+			if err != nil {
+				t.Fatalf("argp parse: %v", err)
+			}
+
+			got := s
+			if testCase.cmd == "run" {
+				got = sub
+			}
+			if testCase.cmd != "" && cmd.Name != testCase.cmd {
+				t.Errorf("expected command %v, got %v", testCase.cmd, cmd.Name)
+			}
+			if diff := cmp.Diff(testCase.expected, got, diffOpts...); diff != "" {
+				t.Errorf("mismatch (-expected +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(testCase.forward, forward.Forward, diffOpts...); diff != "" {
+				t.Errorf("forward mismatch (-expected +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+type SCopy struct {
+	Force   bool     `short:"f"`
+	Sources []string `index:"*"`
+	Dest    string   `index:"-1"`
+}
+
+func (_ *SCopy) Run() error {
+	return nil
+}
+
+func TestArgpTrailing(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		arguments []string
+		expected  SCopy
+	}{
+		{[]string{"a"}, SCopy{Dest: "a"}},
+		{[]string{"a", "b"}, SCopy{Sources: []string{"a"}, Dest: "b"}},
+		{[]string{"a", "-f", "b", "c"}, SCopy{Force: true, Sources: []string{"a", "b"}, Dest: "c"}},
+		{[]string{"a", "--", "-b"}, SCopy{Sources: []string{"a"}, Dest: "-b"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(fmt.Sprintf("%v", testCase.arguments), func(t *testing.T) {
+			t.Parallel()
+
+			s := SCopy{}
+			if _, err := NewCmd(&s, "description").selectCmd(testCase.arguments); err != nil {
+				t.Fatalf("argp parse: %v", err)
+			}
+			if diff := cmp.Diff(testCase.expected, s, diffOpts...); diff != "" {
+				t.Errorf("mismatch (-expected +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestArgpAddTrailingArg(t *testing.T) {
+	t.Parallel()
+
+	var first string
+	var rest []int
+	var second, last string
+	argp := New("description")
+	argp.AddArg(&first, "first", "description")
+	argp.AddRest(&rest, "rest", "description")
+	argp.AddTrailingArg(&second, "second", "description")
+	argp.AddTrailingArg(&last, "last", "description")
+
+	if _, _, err := argp.parse([]string{"a", "1", "2", "b", "c"}); err != nil {
+		t.Fatalf("argp parse: %v", err)
+	}
+	if first != "a" || second != "b" || last != "c" {
+		t.Errorf("expected a, b and c, got %v, %v and %v", first, second, last)
+	}
+	if diff := cmp.Diff([]int{1, 2}, rest, diffOpts...); diff != "" {
+		t.Errorf("mismatch (-expected +got):\n%s", diff)
+	}
+
+	// too few arguments set the first trailing arguments
+	second, last = "", ""
+	if _, _, err := argp.parse([]string{"a", "b"}); err != nil {
+		t.Fatalf("argp parse: %v", err)
+	} else if second != "b" || last != "" || len(rest) != 0 {
+		t.Errorf("expected only second to be set, got %v, %v and %v", second, last, rest)
+	}
+}
+
+type STypedRest struct {
+	Timeout time.Duration
+	Addrs   []netip.Addr `index:"*"`
+}
+
+func (_ *STypedRest) Run() error {
+	return nil
+}
+
+func TestArgpTypedRest(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		arguments []string
+		expected  STypedRest
+		error     error
+		index     int
+	}{
+		{[]string{"--timeout", "1m30s", "::1", "10.0.0.1"}, STypedRest{Timeout: 90 * time.Second, Addrs: []netip.Addr{netip.MustParseAddr("::1"), netip.MustParseAddr("10.0.0.1")}}, nil, 0},
+		{[]string{"--timeout", "5"}, STypedRest{}, argpErrors.ErrInvalidValue, 1},
+		{[]string{"::1", "10.0.0.256"}, STypedRest{}, argpErrors.ErrInvalidValue, 1},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(fmt.Sprintf("%v", testCase.arguments), func(t *testing.T) {
+			t.Parallel()
+
+			s := STypedRest{}
+			_, err := NewCmd(&s, "description").selectCmd(testCase.arguments)
+			if testCase.error != nil {
+				var parseErr *argpErrors.ParseError
+				if !errors.Is(err, testCase.error) || !errors.As(err, &parseErr) {
+					t.Fatalf("error mismatch: expected %q, got %q", testCase.error, err)
+				} else if parseErr.Index != testCase.index {
+					t.Errorf("expected index %v, got %v", testCase.index, parseErr.Index)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("argp parse: %v", err)
+			}
+
+			if diff := cmp.Diff(testCase.expected, s, cmpopts.EquateEmpty(), cmpopts.EquateComparable(netip.Addr{})); diff != "" {
+				t.Errorf("mismatch (-expected +got):\n%s", diff)
+			}
+		})
+	}
+
+	var ints []int
+	argp := New("description")
+	argp.AddRest(&ints, "ints", "description")
+	_, _, err := argp.parse([]string{"1", "x", "3"})
+	var parseErr *argpErrors.ParseError
+	if !errors.Is(err, strconv.ErrSyntax) || !errors.As(err, &parseErr) {
+		t.Fatalf("error mismatch: expected %q, got %q", strconv.ErrSyntax, err)
+	} else if parseErr.Index != 1 || parseErr.Type != "int" || parseErr.Name != "ints" {
+		t.Errorf("expected ints at index 1 with type int, got %v at index %v with type %v", parseErr.Name, parseErr.Index, parseErr.Type)
+	}
+}
+
+type SCount struct {
+	Tags  Append   `short:"t" max:"2"`
+	Name  string   `min:"1"`
+	Files []string `index:"*" min:"1" max:"3"`
+}
+
+func (_ *SCount) Run() error {
+	return nil
+}
+
+func TestArgpCountConstraints(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		arguments []string
+		collect   bool
+		names     []string
+		indices   []int
+		message   string
+	}{
+		{[]string{"--name", "x", "a"}, false, nil, nil, ""},
+		{[]string{"--name", "x", "-t", "1", "-t", "2", "a", "b", "c"}, false, nil, nil, ""},
+		{[]string{"--name", "x"}, false, []string{"files"}, []int{2}, "files: wrong number of values: expected 1 to 3, got 0"},
+		{[]string{"a"}, false, []string{"--name"}, []int{1}, "--name: wrong number of values: expected at least 1, got 0"},
+		{[]string{"--name", "x", "-t", "1", "a", "-t", "2", "--tags", "3"}, false, []string{"--tags"}, []int{7}, "--tags: wrong number of values: expected at most 2, got 3"},
+		{[]string{"a", "b", "c", "d", "e"}, true, []string{"files", "--name"}, []int{3, 5}, ""},
+		{[]string{"--bogus", "--name", "x", "-t1", "-t2", "-t3"}, true, []string{"--bogus", "--tags", "files"}, []int{0, 5, 6}, ""},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(fmt.Sprintf("%v", testCase.arguments), func(t *testing.T) {
+			t.Parallel()
+
+			var tags []string
+			s := SCount{Tags: Append{I: &tags}}
+			argp := NewCmd(&s, "description")
+			argp.CollectErrors = testCase.collect
+
+			_, errs := argp.parseCmd(testCase.arguments)
+			var names []string
+			var indices []int
+			for _, err := range errs {
+				var parseErr *argpErrors.ParseError
+				if !errors.As(err, &parseErr) {
+					t.Fatalf("expected a ParseError, got %q", err)
+				}
+				names = append(names, parseErr.Name)
+				indices = append(indices, parseErr.Index)
+			}
+			if diff := cmp.Diff(testCase.names, names, diffOpts...); diff != "" {
+				t.Errorf("names mismatch (-expected +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(testCase.indices, indices, diffOpts...); diff != "" {
+				t.Errorf("indices mismatch (-expected +got):\n%s", diff)
+			}
+			if testCase.message != "" && (len(errs) != 1 || !errors.Is(errs[0], argpErrors.ErrCount) || errs[0].Error() != testCase.message) {
+				t.Errorf("expected error %q, got %q", testCase.message, errs)
+			}
+		})
+	}
+}
+
+type SRename struct {
+	Old string
+	New string
+}
+
+type SNargs struct {
+	Point   [3]int   `short:"p" nargs:"3"`
+	Rename  SRename  `nargs:"2" default:"a b"`
+	Pair    []string `nargs:"2"`
+	Verbose bool     `short:"v"`
+}
+
+func (_ *SNargs) Run() error {
+	return nil
+}
+
+func TestArgpNargs(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		arguments []string
+		expected  SNargs
+		error     error
+		index     int
+	}{
+		{[]string{}, SNargs{Rename: SRename{"a", "b"}}, nil, 0},
+		{[]string{"--point", "1", "-2", "3", "-v"}, SNargs{Point: [3]int{1, -2, 3}, Rename: SRename{"a", "b"}, Verbose: true}, nil, 0},
+		{[]string{"-p4", "5", "6", "--rename", "old", "new"}, SNargs{Point: [3]int{4, 5, 6}, Rename: SRename{"old", "new"}}, nil, 0},
+		{[]string{"--pair=x", "y", "--pair", "z", "w"}, SNargs{Rename: SRename{"a", "b"}, Pair: []string{"z", "w"}}, nil, 0},
+		{[]string{"-v", "--point", "1", "x", "3"}, SNargs{}, strconv.ErrSyntax, 3},
+		{[]string{"--point=1", "2", "x"}, SNargs{}, strconv.ErrSyntax, 2},
+		{[]string{"--rename", "old"}, SNargs{}, argpErrors.ErrMissingValue, 1},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(fmt.Sprintf("%v", testCase.arguments), func(t *testing.T) {
+			t.Parallel()
+
+			s := SNargs{}
+			_, err := NewCmd(&s, "description").selectCmd(testCase.arguments)
+			if testCase.error != nil {
+				var parseErr *argpErrors.ParseError
+				if !errors.Is(err, testCase.error) || !errors.As(err, &parseErr) {
+					t.Fatalf("error mismatch: expected %q, got %q", testCase.error, err)
+				} else if parseErr.Index != testCase.index {
+					t.Errorf("expected index %v, got %v", testCase.index, parseErr.Index)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("argp parse: %v", err)
+			}
+
+			if diff := cmp.Diff(testCase.expected, s, diffOpts...); diff != "" {
+				t.Errorf("mismatch (-expected +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestArgpNargsInvalid(t *testing.T) {
+	t.Parallel()
+
+	s := SNargs{}
+	argp := NewCmd(&s, "description")
+	argp.CollectErrors = true
+
+	_, err := argp.selectCmd([]string{"--point", "7", "8", "9", "--point", "1", "x", "3", "-v"})
+	if !errors.Is(err, strconv.ErrSyntax) {
+		t.Fatalf("error mismatch: expected %q, got %q", strconv.ErrSyntax, err)
+	}
+
+	expected := SNargs{Point: [3]int{7, 8, 9}, Rename: SRename{"a", "b"}, Verbose: true}
+	if diff := cmp.Diff(expected, s, diffOpts...); diff != "" {
+		t.Errorf("mismatch (-expected +got):\n%s", diff)
+	}
+}
+
+type SOptional struct {
+	Color   string   `short:"c" optional:"auto"`
+	Level   int      `optional:"1"`
+	Verbose bool     `short:"v"`
+	Force   bool     `short:"f" optional:"true"`
+	Args    []string `index:"*"`
+}
+
+func (_ *SOptional) Run() error {
+	return nil
+}
+
+func TestArgpOptional(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		arguments []string
+		expected  SOptional
+		error     error
+	}{
+		{[]string{"--color"}, SOptional{Color: "auto"}, nil},
+		{[]string{"--color=never"}, SOptional{Color: "never"}, nil},
+		{[]string{"--color=", "x"}, SOptional{Args: []string{"x"}}, nil},
+		{[]string{"--color", "never"}, SOptional{Color: "auto", Args: []string{"never"}}, nil},
+		{[]string{"-c", "never"}, SOptional{Color: "auto", Args: []string{"never"}}, nil},
+		{[]string{"-vc=always"}, SOptional{Color: "always", Verbose: true}, nil},
+		{[]string{"-cv"}, SOptional{Color: "auto", Verbose: true}, nil},
+		{[]string{"--level", "5"}, SOptional{Level: 1, Args: []string{"5"}}, nil},
+		{[]string{"--level=5"}, SOptional{Level: 5}, nil},
+		{[]string{"--level=x"}, SOptional{}, strconv.ErrSyntax},
+		{[]string{"--verbose", "false", "a"}, SOptional{Args: []string{"a"}}, nil},
+		{[]string{"--verbose", "true"}, SOptional{Verbose: true}, nil},
+		{[]string{"-v", "false"}, SOptional{}, nil},
+		{[]string{"-cv", "false"}, SOptional{Color: "auto"}, nil},
+		{[]string{"-vc", "false"}, SOptional{Color: "auto", Verbose: true, Args: []string{"false"}}, nil},
+		{[]string{"--verbose", "a"}, SOptional{Verbose: true, Args: []string{"a"}}, nil},
+		{[]string{"--force", "false"}, SOptional{Force: true, Args: []string{"false"}}, nil},
+		{[]string{"-v=false"}, SOptional{}, nil},
+		{[]string{"--verbose=maybe"}, SOptional{}, strconv.ErrSyntax},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(fmt.Sprintf("%v", testCase.arguments), func(t *testing.T) {
+			t.Parallel()
+
+			s := SOptional{}
+			_, err := NewCmd(&s, "description").selectCmd(testCase.arguments)
+			if testCase.error != nil {
+				if !errors.Is(err, testCase.error) {
+					t.Errorf("error mismatch: expected %q, got %q", testCase.error, err)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("argp parse: %v", err)
+			}
+
+			if diff := cmp.Diff(testCase.expected, s, diffOpts...); diff != "" {
+				t.Errorf("mismatch (-expected +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestArgpAddOptionalOpt(t *testing.T) {
+	t.Parallel()
+
+	var color string
+	argp := New("description")
+	argp.AddOptionalOpt(&color, "", "color", "auto", "description")
+
+	_, rest, err := argp.parse([]string{"--color", "x"})
+	if err != nil {
+		t.Fatalf("argp parse: %v", err)
+	} else if color != "auto" || len(rest) != 1 {
+		t.Errorf("expected auto and x, got %v and %v", color, rest)
+	}
+}
+
+type SNegative struct {
+	Offset  int       `short:"o"`
+	Scale   float64   `short:"s"`
+	Verbose bool      `short:"1"`
+	Ints    []int     `short:"i"`
+	Values  []float64 `index:"*"`
+}
+
+func (_ *SNegative) Run() error {
+	return nil
+}
+
+func TestArgpNegativeNumbers(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		arguments []string
+		expected  SNegative
+		error     error
+	}{
+		{[]string{"--offset", "-5"}, SNegative{Offset: -5}, nil},
+		{[]string{"-o", "-5", "-o-6"}, SNegative{Offset: -6}, nil},
+		{[]string{"--scale", "-.5", "-s", "-1e3"}, SNegative{Scale: -1000}, nil},
+		{[]string{"--ints", "-1,-2", "-i=-3"}, SNegative{Ints: []int{-1, -2, -3}}, nil},
+		{[]string{"-5", "2", "-2.5", "-.5"}, SNegative{Values: []float64{-5, 2, -2.5, -0.5}}, nil},
+		{[]string{"-o", "3", "-7", "--", "-8"}, SNegative{Offset: 3, Values: []float64{-7, -8}}, nil},
+		{[]string{"-1"}, SNegative{Values: []float64{-1}}, nil},
+		{[]string{"-1.5"}, SNegative{Values: []float64{-1.5}}, nil},
+		{[]string{"-x5"}, SNegative{}, argpErrors.ErrUnknownOption},
+		{[]string{"-.x"}, SNegative{}, argpErrors.ErrUnknownOption},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(fmt.Sprintf("%v", testCase.arguments), func(t *testing.T) {
+			t.Parallel()
+
+			s := SNegative{}
+			_, err := NewCmd(&s, "description").selectCmd(testCase.arguments)
+			if testCase.error != nil {
+				if !errors.Is(err, testCase.error) {
+					t.Errorf("error mismatch: expected %q, got %q", testCase.error, err)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("argp parse: %v", err)
+			}
+
+			if diff := cmp.Diff(testCase.expected, s, diffOpts...); diff != "" {
+				t.Errorf("mismatch (-expected +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+type SNegativeArgs struct {
+	Verbose bool     `short:"1"`
+	Level   int      `index:"0"`
+	Args    []string `index:"*"`
+}
+
+func (_ *SNegativeArgs) Run() error {
+	return nil
+}
+
+func TestArgpNegativeShort(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		arguments []string
+		expected  SNegativeArgs
+		error     error
+	}{
+		{[]string{"-1"}, SNegativeArgs{Level: -1}, nil},
+		{[]string{"2", "-1"}, SNegativeArgs{Verbose: true, Level: 2}, nil},
+		{[]string{"2", "-3", "-1"}, SNegativeArgs{Verbose: true, Level: 2, Args: []string{"-3"}}, nil},
+		{[]string{"2", "-1.5"}, SNegativeArgs{}, argpErrors.ErrUnknownOption},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(fmt.Sprintf("%v", testCase.arguments), func(t *testing.T) {
+			t.Parallel()
+
+			s := SNegativeArgs{}
+			_, err := NewCmd(&s, "description").selectCmd(testCase.arguments)
+			if testCase.error != nil {
+				if !errors.Is(err, testCase.error) {
+					t.Errorf("error mismatch: expected %q, got %q", testCase.error, err)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("argp parse: %v", err)
+			}
+
+			if diff := cmp.Diff(testCase.expected, s, diffOpts...); diff != "" {
+				t.Errorf("mismatch (-expected +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCountNegative(t *testing.T) {
+	t.Parallel()
+
+	var i int
+	var u uint
+	var rest []string
+	argp := New("description")
+	argp.AddOpt(Count{&i}, "i", "int", "description")
+	argp.AddOpt(Count{&u}, "u", "uint", "description")
+	argp.AddRest(&rest, "rest", "description")
+
+	_, _, err := argp.parse([]string{"-i", "-3", "-u", "-4"})
+	if err != nil {
+		t.Fatalf("argp parse: %v", err)
+	}
+	if i != 1 || u != 1 {
+		t.Errorf("expected 1 and 1, got %v and %v", i, u)
+	}
+	if diff := cmp.Diff([]string{"-3", "-4"}, rest, diffOpts...); diff != "" {
+		t.Errorf("mismatch (-expected +got):\n%s", diff)
+	}
+
+	_, _, err = argp.parse([]string{"-i=-3", "--int=-5", "x"})
+	if err != nil {
+		t.Fatalf("argp parse: %v", err)
+	}
+	if i != -5 {
+		t.Errorf("expected -5, got %v", i)
+	}
+	if diff := cmp.Diff([]string{"x"}, rest, diffOpts...); diff != "" {
+		t.Errorf("mismatch (-expected +got):\n%s", diff)
+	}
+
+	if _, _, err := argp.parse([]string{"-u=-4"}); !errors.Is(err, strconv.ErrSyntax) {
+		t.Errorf("error mismatch: expected %q, got %q", strconv.ErrSyntax, err)
+	}
+}
+
+type SCommonFlags struct {
+	Verbose bool `short:"v"`
+	Output  string
+}
+
+type SDatabaseFlags struct {
+	Host string
+	Port int `default:"5432"`
+}
+
+type SEmbedServe struct {
+	SCommonFlags
+	*SDatabaseFlags `prefix:"db-"`
+	Replica         SDatabaseFlags `name:"replica"`
+}
+
+func (_ *SEmbedServe) Run() error {
+	return nil
+}
+
+type SEmbedMigrate struct {
+	SCommonFlags
+	Steps int
+}
+
+func (_ *SEmbedMigrate) Run() error {
+	return nil
+}
+
+func TestArgpEmbedded(t *testing.T) {
+	t.Parallel()
+
+	serve := SEmbedServe{}
+	migrate := SEmbedMigrate{}
+	argp := New("description")
+	argp.AddCmd(&serve, "serve", "description")
+	argp.AddCmd(&migrate, "migrate", "description")
+
+	if _, err := argp.selectCmd([]string{"serve", "-v", "--output", "out", "--db-host", "localhost"}); err != nil {
+		t.Fatalf("argp parse: %v", err)
+	}
+	expected := SEmbedServe{
+		SCommonFlags:   SCommonFlags{Verbose: true, Output: "out"},
+		SDatabaseFlags: &SDatabaseFlags{Host: "localhost", Port: 5432},
+	}
+	if diff := cmp.Diff(expected, serve, diffOpts...); diff != "" {
+		t.Errorf("mismatch (-expected +got):\n%s", diff)
+	}
+
+	if _, err := argp.selectCmd([]string{"migrate", "--steps", "2", "--output", "x"}); err != nil {
+		t.Fatalf("argp parse: %v", err)
+	} else if migrate.Output != "x" || migrate.Steps != 2 {
+		t.Errorf("expected x and 2, got %v and %v", migrate.Output, migrate.Steps)
+	}
+
+	if _, err := argp.selectCmd([]string{"serve", "--host", "x"}); !errors.Is(err, argpErrors.ErrUnknownOption) {
+		t.Errorf("error mismatch: expected %q, got %q", argpErrors.ErrUnknownOption, err)
+	}
+}
+
+type SEmbedPrefix struct {
+	Name string `prefix:"x-"`
+}
+
+func (_ *SEmbedPrefix) Run() error {
+	return nil
+}
+
+type SEmbedDuplicate struct {
+	SCommonFlags
+	Output string
+}
+
+func (_ *SEmbedDuplicate) Run() error {
+	return nil
+}
+
+func TestArgpEmbeddedPanics(t *testing.T) {
+	t.Parallel()
+
+	for _, cmd := range []Cmd{&SEmbedPrefix{}, &SEmbedDuplicate{}} {
+		t.Run(fmt.Sprintf("%T", cmd), func(t *testing.T) {
+			t.Parallel()
+
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected a panic")
+				}
+			}()
+			NewCmd(cmd, "description")
+		})
+	}
+}
+
+type sState struct {
+	Calls int
+}
+
+type sOptions struct {
+	Debug bool
+}
+
+type SIgnored struct {
+	sOptions
+	*sState
+	Name    string
+	logger  *strings.Builder
+	client  chan int
+	Cache   map[string]func() `argp:"-"`
+	Skipped string            `argp:"-"`
+}
+
+func (s *SIgnored) Run() error {
+	s.logger.WriteString(s.Name)
+	return nil
+}
+
+func TestArgpIgnoredFields(t *testing.T) {
+	t.Parallel()
+
+	s := SIgnored{logger: &strings.Builder{}, sState: &sState{Calls: 1}}
+	argp := NewCmd(&s, "description")
+
+	if err := argp.ParseArgs([]string{"--name", "x", "--debug"}); err != nil {
+		t.Fatalf("argp parse: %v", err)
+	} else if s.logger.String() != "x" || !s.Debug || s.Calls != 1 {
+		t.Errorf("expected x, debug and the state to be kept, got %v, %v and %v", s.logger.String(), s.Debug, s.Calls)
+	}
+
+	for _, name := range []string{"--logger", "--client", "--cache", "--skipped", "--calls"} {
+		if _, err := argp.selectCmd([]string{name, "x"}); !errors.Is(err, argpErrors.ErrUnknownOption) {
+			t.Errorf("%v: error mismatch: expected %q, got %q", name, argpErrors.ErrUnknownOption, err)
+		}
+	}
+}
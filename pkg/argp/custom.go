@@ -10,7 +10,12 @@ type ArgumentScanner interface {
 	Scan(string, []string) (int, error)
 }
 
-// Count is a counting option, e.g. -vvv sets the count to 3, or -v=3 sets it directly.
+// attachedScanner is an ArgumentScanner that scans a value attached to its option with = differently, e.g. -v=-3.
+type attachedScanner interface {
+	scanAttached(string, []string) (int, error)
+}
+
+// Count is a counting option, e.g. -vvv sets the count to 3, or -v=3 sets it directly. A negative count must be attached, e.g. -v=-3.
 type Count struct {
 	I any
 }
@@ -27,6 +32,14 @@ func (count Count) Help() (string, string) {
 }
 
 func (count Count) Scan(name string, s []string) (int, error) {
+	return count.scan(s, false)
+}
+
+func (count Count) scanAttached(name string, s []string) (int, error) {
+	return count.scan(s, true)
+}
+
+func (count Count) scan(s []string, attached bool) (int, error) {
 	if reflect.TypeOf(count.I).Kind() != reflect.Ptr {
 		return 0, fmt.Errorf("variable must be a pointer to an integer type")
 	}
@@ -40,8 +53,8 @@ func (count Count) Scan(name string, s []string) (int, error) {
 		return 0, fmt.Errorf("variable must be a pointer to an integer type")
 	}
 
-	if 0 < len(s) && 0 < len(s[0]) && '0' <= s[0][0] && s[0][0] <= '9' {
-		// don't parse negatives or other options
+	if attached || 0 < len(s) && 0 < len(s[0]) && '0' <= s[0][0] && s[0][0] <= '9' {
+		// don't parse negatives or other options that follow the option
 		return scanValue(v, s)
 	} else if isInt {
 		v.SetInt(v.Int() + 1)
@@ -0,0 +1,622 @@
+package argp
+
+import (
+	"fmt"
+	motmedelErrors "github.com/Motmedel/utils_go/pkg/errors"
+	argpErrors "github.com/vphpersson/argp/pkg/errors"
+	argpVariable "github.com/vphpersson/argp/pkg/types/variable"
+	"io"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// DefaultHelpTemplate is the template used by `Argp.PrintHelp` unless Argp.HelpTemplate is set.
+//
+// The template is executed with a Help value and can use the following functions:
+//   - `column WIDTH GAP LABEL` pads LABEL to WIDTH columns, or moves to a new line indented by WIDTH columns when fewer than GAP columns would remain.
+//   - `wrap INDENT TEXT` wraps TEXT to the terminal width, assuming it starts at column INDENT and indenting the following lines by INDENT columns.
+const DefaultHelpTemplate = `
+{{- range .Usages}}Usage: {{.}}
+{{end}}
+{{- if .LongDescription}}
+{{wrap 0 .LongDescription}}
+{{else if .Description}}
+{{wrap 0 .Description}}
+{{end}}
+{{- if .Options}}
+Options:
+{{range .Options}}{{column $.OptionWidth 1 .Label}}{{wrap $.OptionWidth .Description}}
+{{end}}
+{{- end}}
+{{- range $section := .Sections}}
+{{$section.Title}}:
+{{range $section.Options}}{{column $section.Width 1 .Label}}{{wrap $section.Width .Description}}
+{{end}}
+{{- end}}
+{{- if .GlobalOptions}}
+Global options:
+{{range .GlobalOptions}}{{column $.GlobalOptionWidth 1 .Label}}{{wrap $.GlobalOptionWidth .Description}}
+{{end}}
+{{- end}}
+{{- if .Commands}}
+Commands:
+{{range .Commands}}{{column $.CommandWidth 2 .Label}}{{wrap $.CommandWidth .Description}}
+{{end}}
+{{- end}}
+{{- if .Topics}}
+Help topics:
+{{range .Topics}}{{column $.TopicWidth 2 .Label}}{{wrap $.TopicWidth .Description}}
+{{end}}
+{{- end}}
+{{- if .Arguments}}
+Arguments:
+{{range .Arguments}}{{column $.ArgumentWidth 2 .Label}}{{wrap $.ArgumentWidth .Description}}
+{{end}}
+{{- end}}
+{{- if .Examples}}
+Examples:
+{{range .Examples}}  {{.Command}}
+{{if .Explanation}}      {{wrap 6 .Explanation}}
+{{end}}
+{{- end}}
+{{- end}}
+{{- if .Epilogue}}
+{{wrap 0 .Epilogue}}
+{{end}}`
+
+// Help is the data passed to the help template.
+type Help struct {
+	Name            string // command path, e.g. "prog sub"
+	Description     string
+	LongDescription string
+	Examples        []Example
+	Epilogue        string
+	Usages          []string     // usage lines without the "Usage: " prefix
+	Options         []HelpOption // options without a section
+	Sections        []HelpSection
+	GlobalOptions   []HelpOption // persistent options of the parent commands
+	Commands        []HelpCommand
+	Topics          []HelpTopic
+	Arguments       []HelpArgument
+
+	// Width is the terminal width that text is wrapped to.
+	Width int
+
+	// Widths of the label columns, the description starts after them.
+	OptionWidth       int
+	GlobalOptionWidth int
+	CommandWidth      int
+	TopicWidth        int
+	ArgumentWidth     int
+}
+
+// Example is a worked example of a command line.
+type Example struct {
+	Command     string // e.g. "prog deploy --force prod"
+	Explanation string
+}
+
+// HelpSection is a named group of options in the help.
+type HelpSection struct {
+	Title   string
+	Options []HelpOption
+	Width   int // width of the label column
+}
+
+// HelpOption is an option in the help.
+type HelpOption struct {
+	Short       string // short name, with its default value if it has no long name
+	Name        string // long name, with its default value
+	Type        string
+	Description string
+	Label       string // e.g. "  -s, --name=default string"
+}
+
+// HelpCommand is a sub command in the help.
+type HelpCommand struct {
+	Name        string
+	Aliases     []string
+	Description string
+	Label       string // e.g. "  name, alias"
+}
+
+// HelpTopic is a help topic in the help.
+type HelpTopic struct {
+	Name        string
+	Description string
+	Label       string // e.g. "  name"
+}
+
+// HelpArgument is an indexed or rest argument in the help.
+type HelpArgument struct {
+	Name        string
+	Rest        bool
+	Description string
+	Label       string // e.g. "  name"
+}
+
+// nargsPlaceholders returns the placeholders of an option with n arguments, which are the field names of a struct or else the element types.
+func nargsPlaceholders(t reflect.Type, n int) string {
+	placeholders := make([]string, n)
+	for k := range placeholders {
+		if t.Kind() == reflect.Struct {
+			placeholders[k] = fromFieldname(t.Field(k).Name)
+		} else {
+			placeholders[k] = TypeName(t.Elem())
+		}
+	}
+	return strings.Join(placeholders, " ")
+}
+
+// nargsValues returns the elements or fields of the value of an option with several arguments separated by spaces.
+func nargsValues(v reflect.Value) string {
+	var values []string
+	if v.Kind() == reflect.Struct {
+		for k := range v.NumField() {
+			values = append(values, fmt.Sprint(v.Field(k).Interface()))
+		}
+	} else {
+		for k := range v.Len() {
+			values = append(values, fmt.Sprint(v.Index(k).Interface()))
+		}
+	}
+	return strings.Join(values, " ")
+}
+
+func getOptionHelps(vs []*argpVariable.Variable) []HelpOption {
+	var helps []HelpOption
+
+	for _, v := range vs {
+		var val, typ string
+		if custom, ok := v.Value.Interface().(ArgumentScanner); ok {
+			val, typ = custom.Help()
+		} else {
+			if v.Default != nil && !reflect.ValueOf(v.Default).IsZero() {
+				val = fmt.Sprint(v.Default)
+			}
+			typ = TypeName(v.Value.Type())
+			if v.Nargs != 0 {
+				if val != "" {
+					val = nargsValues(reflect.ValueOf(v.Default))
+				}
+				typ = nargsPlaceholders(v.Value.Type(), v.Nargs)
+			}
+		}
+
+		var short, name string
+		if v.Short != 0 {
+			short = string(v.Short)
+		}
+		name = v.Name
+		if val != "" {
+			if space := strings.IndexByte(val, ' '); space != -1 {
+				val = "'" + val + "'"
+			}
+			if name != "" {
+				name += "=" + val
+			} else {
+				short += "=" + val
+			}
+		}
+
+		label := ""
+		if short != "" {
+			label = "  -" + short + ", --" + name
+		} else if name != "" {
+			label = "      --" + name
+		}
+		if typ != "" && v.Optional {
+			label += "[=" + typ + "]"
+		} else if typ != "" {
+			label += " " + typ
+		}
+
+		helps = append(helps, HelpOption{
+			Short:       short,
+			Name:        name,
+			Type:        typ,
+			Description: v.Description,
+			Label:       label,
+		})
+	}
+	return helps
+}
+
+// optionWidth returns the width of the option label column.
+func optionWidth(options []HelpOption) int {
+	nMax := 0
+	for _, o := range options {
+		n := stringWidth(o.Label) + 1 // whitespace before description
+		if nMax < n {
+			nMax = n
+		}
+	}
+	return min(max(nMax, 10), 30)
+}
+
+// labelWidth returns the width of the command or argument label column.
+func labelWidth(labels []string) int {
+	nMax := 0
+	for _, label := range labels {
+		if n := stringWidth(label); nMax < n {
+			nMax = n
+		}
+	}
+	return min(max(nMax, 10), 28) + 2
+}
+
+// column pads the label to the width, or moves to a new line when fewer than gap columns would remain.
+func column(width, gap int, label string) string {
+	n := stringWidth(label)
+	if width < n+gap {
+		label += "\n"
+		n = 0
+	}
+	return label + strings.Repeat(" ", width-n)
+}
+
+// helpData returns the data for the help template.
+func (argp *Argp) helpData() Help {
+	base := argp.Name
+	parent := argp.parent
+	for parent != nil {
+		base = parent.Name + " " + base
+		parent = parent.parent
+	}
+
+	h := Help{
+		Name:            base,
+		Description:     argp.Description,
+		LongDescription: argp.LongDescription,
+		Examples:        argp.Examples,
+		Epilogue:        argp.Epilogue,
+		Width:           argp.helpWidth(),
+	}
+
+	declarationOrder := argp.declarationOrder()
+	var options []*argpVariable.Variable
+	var arguments []*argpVariable.Variable
+	var sections []string
+	sectionOptions := map[string][]*argpVariable.Variable{}
+	for _, v := range argp.vars {
+		if v.PassThrough {
+			continue
+		} else if v.IsArgument() {
+			arguments = append(arguments, v)
+		} else if v.Section != "" {
+			if _, ok := sectionOptions[v.Section]; !ok {
+				sections = append(sections, v.Section)
+			}
+			sectionOptions[v.Section] = append(sectionOptions[v.Section], v)
+		} else {
+			options = append(options, v)
+		}
+	}
+
+	if !declarationOrder {
+		sort.Slice(options, sortOption(options))
+	}
+	sort.Slice(arguments, sortArgument(arguments))
+
+	args := ""
+	if 0 < len(options) || 0 < len(sections) {
+		args += " [options]"
+	}
+	if 0 < len(argp.cmds) {
+		h.Usages = append(h.Usages, base+args+" [command] ...")
+	}
+	for _, v := range arguments {
+		if v.Rest && v.Min == 0 {
+			args += " [" + v.Name + "...]"
+		} else if v.Rest {
+			args += " " + v.Name + "..."
+		} else {
+			args += " " + v.Name
+		}
+	}
+	if 0 < len(arguments) || len(argp.cmds) == 0 {
+		h.Usages = append(h.Usages, base+args)
+	}
+
+	h.Options = getOptionHelps(options)
+	h.OptionWidth = optionWidth(h.Options)
+
+	for _, section := range sections {
+		vs := sectionOptions[section]
+		if !declarationOrder {
+			sort.Slice(vs, sortOption(vs))
+		}
+		helps := getOptionHelps(vs)
+		h.Sections = append(h.Sections, HelpSection{
+			Title:   section,
+			Options: helps,
+			Width:   optionWidth(helps),
+		})
+	}
+
+	globals := argp.persistentVars()
+	if !declarationOrder {
+		sort.Slice(globals, sortOption(globals))
+	}
+	h.GlobalOptions = getOptionHelps(globals)
+	h.GlobalOptionWidth = optionWidth(h.GlobalOptions)
+
+	var cmds []string
+	for cmd, sub := range argp.cmds {
+		if !slices.Contains(sub.aliases, cmd) {
+			cmds = append(cmds, cmd)
+		}
+	}
+	sort.Strings(cmds)
+	var labels []string
+	for _, cmd := range cmds {
+		sub := argp.cmds[cmd]
+		label := "  " + strings.Join(append([]string{cmd}, sub.aliases...), ", ")
+		labels = append(labels, label)
+		h.Commands = append(h.Commands, HelpCommand{
+			Name:        cmd,
+			Aliases:     sub.aliases,
+			Description: sub.Description,
+			Label:       label,
+		})
+	}
+	h.CommandWidth = labelWidth(labels)
+
+	labels = labels[:0]
+	for _, topic := range argp.topics {
+		label := "  " + topic.name
+		labels = append(labels, label)
+		h.Topics = append(h.Topics, HelpTopic{
+			Name:        topic.name,
+			Description: topic.description,
+			Label:       label,
+		})
+	}
+	h.TopicWidth = labelWidth(labels)
+
+	labels = labels[:0]
+	for _, v := range arguments {
+		label := "  " + v.Name
+		labels = append(labels, label)
+		h.Arguments = append(h.Arguments, HelpArgument{
+			Name:        v.Name,
+			Rest:        v.Rest,
+			Description: v.Description,
+			Label:       label,
+		})
+	}
+	h.ArgumentWidth = labelWidth(labels)
+
+	return h
+}
+
+// declarationOrder returns true if the command or any of its parents lists options in declaration order.
+func (argp *Argp) declarationOrder() bool {
+	for a := argp; a != nil; a = a.parent {
+		if a.DeclarationOrder {
+			return true
+		}
+	}
+	return false
+}
+
+// helpTemplate returns the help template of the command or its closest parent that has one.
+func (argp *Argp) helpTemplate() string {
+	for a := argp; a != nil; a = a.parent {
+		if a.HelpTemplate != "" {
+			return a.HelpTemplate
+		}
+	}
+	return DefaultHelpTemplate
+}
+
+// helpWidth returns the width that the help is wrapped to: the help width of the command or its closest parent that has one, the COLUMNS environment variable, or 80.
+func (argp *Argp) helpWidth() int {
+	for a := argp; a != nil; a = a.parent {
+		if 0 < a.HelpWidth {
+			return a.HelpWidth
+		}
+	}
+	if columns, ok := argp.lookupEnv("COLUMNS"); ok {
+		if width, err := strconv.Atoi(strings.TrimSpace(columns)); err == nil && 0 < width {
+			return width
+		}
+	}
+	return 80
+}
+
+// PrintHelp prints the help overview. This is automatically called when unknown or bad options are passed, but you can call this explicitly in other cases.
+func (argp *Argp) PrintHelp() error {
+	return argp.printHelp(argp.stdout())
+}
+
+func (argp *Argp) printHelp(w io.Writer) error {
+	h := argp.helpData()
+	tmpl, err := template.New("help").Funcs(template.FuncMap{
+		"column": column,
+		"wrap": func(indent int, text string) string {
+			return wrap(text, indent, h.Width)
+		},
+	}).Parse(argp.helpTemplate())
+	if err != nil {
+		return fmt.Errorf("template parse: %w", err)
+	}
+
+	if err := tmpl.Execute(w, h); err != nil {
+		return fmt.Errorf("template execute: %w", err)
+	}
+	return nil
+}
+
+// helpTopic is a help topic that is not a command.
+type helpTopic struct {
+	name, description, text string
+}
+
+// AddHelpTopic adds a help topic, which is listed in the help and printed by the help command, e.g. `prog help environment`.
+func (argp *Argp) AddHelpTopic(name, description, text string) {
+	if argp.findTopic(name) != nil {
+		panic(fmt.Sprintf("help topic already exists: %v", name))
+	} else if len(name) == 0 || name[0] == '-' {
+		panic("invalid help topic name")
+	}
+	argp.topics = append(argp.topics, helpTopic{strings.ToLower(name), description, text})
+}
+
+func (argp *Argp) findTopic(name string) *helpTopic {
+	name = strings.ToLower(name)
+	for i := range argp.topics {
+		if argp.topics[i].name == name {
+			return &argp.topics[i]
+		}
+	}
+	return nil
+}
+
+// helpCmd is the help command, which prints the help of a command or a help topic.
+type helpCmd struct {
+	argp *Argp
+	path []string
+}
+
+// AddHelpCmd adds a help sub command, so that `prog help deploy` prints the same help as `prog deploy --help`, and `prog help TOPIC` prints a help topic.
+func (argp *Argp) AddHelpCmd() *Argp {
+	h := &helpCmd{argp: argp}
+	sub := argp.AddCmd(nil, "help", "Show help for a command or topic")
+	sub.AddRest(&h.path, "command", "Command path or help topic")
+	sub.Cmd = h
+	return sub
+}
+
+func (h *helpCmd) Run() error {
+	target := h.argp
+	for _, name := range h.path {
+		if topic := target.findTopic(name); topic != nil {
+			_, err := fmt.Fprintln(target.stdout(), wrap(topic.text, 0, target.helpWidth()))
+			return err
+		}
+
+		sub, err := target.lookupCmd(name)
+		if err != nil {
+			return err
+		} else if sub == nil {
+			names := target.cmdNames()
+			for _, topic := range target.topics {
+				names = append(names, topic.name)
+			}
+			return motmedelErrors.NewWithTrace(&argpErrors.SuggestionError{
+				Err:         argpErrors.ErrUnknownCommand,
+				Name:        name,
+				Suggestions: suggest(name, names),
+			})
+		}
+		target = sub
+	}
+	return target.PrintHelp()
+}
+
+// minWrapWidth is the narrowest column that text is wrapped to, regardless of the indentation.
+const minWrapWidth = 20
+
+// wrap wraps text at spaces so that lines fit in width columns, assuming the text starts at column indent. Following lines are indented by indent columns. Line breaks in the text are kept.
+func wrap(text string, indent, width int) string {
+	avail := max(width-indent, minWrapWidth)
+	padding := strings.Repeat(" ", indent)
+
+	var b strings.Builder
+	for i, line := range strings.Split(text, "\n") {
+		if i != 0 {
+			b.WriteString("\n" + padding)
+		}
+		n := 0
+		for j, word := range strings.Fields(line) {
+			w := stringWidth(word)
+			if j != 0 {
+				if avail < n+1+w {
+					b.WriteString("\n" + padding)
+					n = 0
+				} else {
+					b.WriteByte(' ')
+					n++
+				}
+			}
+			b.WriteString(word)
+			n += w
+		}
+	}
+	return b.String()
+}
+
+// stringWidth returns the number of terminal columns that the string occupies.
+func stringWidth(s string) int {
+	n := 0
+	for _, r := range s {
+		n += runeWidth(r)
+	}
+	return n
+}
+
+// wideRanges are the ranges of runes whose East Asian Width is wide (W) or fullwidth (F) in Unicode 15.0, which occupy two terminal columns.
+var wideRanges = []struct{ lo, hi rune }{
+	{0x1100, 0x115F}, {0x231A, 0x231B}, {0x2329, 0x232A},
+	{0x23E9, 0x23EC}, {0x23F0, 0x23F0}, {0x23F3, 0x23F3},
+	{0x25FD, 0x25FE}, {0x2614, 0x2615}, {0x2648, 0x2653},
+	{0x267F, 0x267F}, {0x2693, 0x2693}, {0x26A1, 0x26A1},
+	{0x26AA, 0x26AB}, {0x26BD, 0x26BE}, {0x26C4, 0x26C5},
+	{0x26CE, 0x26CE}, {0x26D4, 0x26D4}, {0x26EA, 0x26EA},
+	{0x26F2, 0x26F3}, {0x26F5, 0x26F5}, {0x26FA, 0x26FA},
+	{0x26FD, 0x26FD}, {0x2705, 0x2705}, {0x270A, 0x270B},
+	{0x2728, 0x2728}, {0x274C, 0x274C}, {0x274E, 0x274E},
+	{0x2753, 0x2755}, {0x2757, 0x2757}, {0x2795, 0x2797},
+	{0x27B0, 0x27B0}, {0x27BF, 0x27BF}, {0x2B1B, 0x2B1C},
+	{0x2B50, 0x2B50}, {0x2B55, 0x2B55}, {0x2E80, 0x2E99},
+	{0x2E9B, 0x2EF3}, {0x2F00, 0x2FD5}, {0x2FF0, 0x2FFF},
+	{0x3000, 0x303E}, {0x3041, 0x3096}, {0x3099, 0x30FF},
+	{0x3105, 0x312F}, {0x3131, 0x318E}, {0x3190, 0x31E3},
+	{0x31EF, 0x321E}, {0x3220, 0x3247}, {0x3250, 0x4DBF},
+	{0x4E00, 0xA48C}, {0xA490, 0xA4C6}, {0xA960, 0xA97C},
+	{0xAC00, 0xD7A3}, {0xF900, 0xFAFF}, {0xFE10, 0xFE19},
+	{0xFE30, 0xFE52}, {0xFE54, 0xFE66}, {0xFE68, 0xFE6B},
+	{0xFF01, 0xFF60}, {0xFFE0, 0xFFE6}, {0x16FE0, 0x16FE4},
+	{0x16FF0, 0x16FF1}, {0x17000, 0x187F7}, {0x18800, 0x18CD5},
+	{0x18D00, 0x18D08}, {0x1AFF0, 0x1AFF3}, {0x1AFF5, 0x1AFFB},
+	{0x1AFFD, 0x1AFFE}, {0x1B000, 0x1B122}, {0x1B132, 0x1B132},
+	{0x1B150, 0x1B152}, {0x1B155, 0x1B155}, {0x1B164, 0x1B167},
+	{0x1B170, 0x1B2FB}, {0x1F004, 0x1F004}, {0x1F0CF, 0x1F0CF},
+	{0x1F18E, 0x1F18E}, {0x1F191, 0x1F19A}, {0x1F200, 0x1F202},
+	{0x1F210, 0x1F23B}, {0x1F240, 0x1F248}, {0x1F250, 0x1F251},
+	{0x1F260, 0x1F265}, {0x1F300, 0x1F320}, {0x1F32D, 0x1F335},
+	{0x1F337, 0x1F37C}, {0x1F37E, 0x1F393}, {0x1F3A0, 0x1F3CA},
+	{0x1F3CF, 0x1F3D3}, {0x1F3E0, 0x1F3F0}, {0x1F3F4, 0x1F3F4},
+	{0x1F3F8, 0x1F43E}, {0x1F440, 0x1F440}, {0x1F442, 0x1F4FC},
+	{0x1F4FF, 0x1F53D}, {0x1F54B, 0x1F54E}, {0x1F550, 0x1F567},
+	{0x1F57A, 0x1F57A}, {0x1F595, 0x1F596}, {0x1F5A4, 0x1F5A4},
+	{0x1F5FB, 0x1F64F}, {0x1F680, 0x1F6C5}, {0x1F6CC, 0x1F6CC},
+	{0x1F6D0, 0x1F6D2}, {0x1F6D5, 0x1F6D7}, {0x1F6DC, 0x1F6DF},
+	{0x1F6EB, 0x1F6EC}, {0x1F6F4, 0x1F6FC}, {0x1F7E0, 0x1F7EB},
+	{0x1F7F0, 0x1F7F0}, {0x1F90C, 0x1F93A}, {0x1F93C, 0x1F945},
+	{0x1F947, 0x1F9FF}, {0x1FA70, 0x1FA7C}, {0x1FA80, 0x1FA88},
+	{0x1FA90, 0x1FABD}, {0x1FABF, 0x1FAC5}, {0x1FACE, 0x1FADB},
+	{0x1FAE0, 0x1FAE8}, {0x1FAF0, 0x1FAF8}, {0x20000, 0x2FFFD},
+	{0x30000, 0x3FFFD},
+}
+
+// runeWidth returns the number of terminal columns that the rune occupies.
+func runeWidth(r rune) int {
+	if unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf) || unicode.IsControl(r) {
+		return 0
+	}
+	for _, wide := range wideRanges {
+		if wide.lo <= r && r <= wide.hi {
+			return 2
+		} else if r < wide.lo {
+			break
+		}
+	}
+	return 1
+}
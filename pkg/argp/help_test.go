@@ -0,0 +1,437 @@
+package argp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	argpErrors "github.com/vphpersson/argp/pkg/errors"
+	"strings"
+	"testing"
+)
+
+type SHelp struct {
+	Foo     string `short:"f" desc:"Foo value"`
+	Bar     int    `default:"3" desc:"Bar count"`
+	Verbose bool   `short:"v" desc:"Verbose output"`
+	File    string `index:"0" desc:"Input file"`
+}
+
+func (_ *SHelp) Run() error {
+	return nil
+}
+
+func TestPrintHelp(t *testing.T) {
+	t.Parallel()
+
+	var stdout strings.Builder
+	argp := NewCmd(&SHelp{}, "description")
+	argp.Name = "prog"
+	argp.Stdout = &stdout
+	argp.AddCmd(&SSub1{}, "sub", "Sub command")
+
+	if err := argp.PrintHelp(); err != nil {
+		t.Fatalf("print help: %v", err)
+	}
+
+	expected := `Usage: prog [options] [command] ...
+Usage: prog [options] file
+
+description
+
+Options:
+      --bar=3 int  Bar count
+  -f, --foo string Foo value
+  -h, --help       Help
+  -v, --verbose    Verbose output
+
+Commands:
+  sub       Sub command
+
+Arguments:
+  file      Input file
+`
+	if got := stdout.String(); got != expected {
+		t.Errorf("mismatch:\nexpected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestPrintHelpTemplate(t *testing.T) {
+	t.Parallel()
+
+	var stdout strings.Builder
+	argp := New("Root description")
+	argp.Name = "prog"
+	argp.Stdout = &stdout
+	argp.HelpTemplate = `{{.Name}}: {{.Description}}{{range .Commands}} [{{.Name}}]{{end}}`
+	sub := argp.AddCmd(&SSub1{}, "sub", "Sub description")
+
+	if err := argp.PrintHelp(); err != nil {
+		t.Fatalf("print help: %v", err)
+	}
+	if expected := "prog: Root description [sub]"; stdout.String() != expected {
+		t.Errorf("expected %q, got %q", expected, stdout.String())
+	}
+
+	stdout.Reset()
+	if err := sub.PrintHelp(); err != nil {
+		t.Fatalf("print help: %v", err)
+	}
+	if expected := "prog sub: Sub description"; stdout.String() != expected {
+		t.Errorf("expected %q, got %q", expected, stdout.String())
+	}
+
+	stdout.Reset()
+	sub.HelpTemplate = `{{range .Options}}{{.Name}} {{end}}`
+	if err := sub.PrintHelp(); err != nil {
+		t.Fatalf("print help: %v", err)
+	}
+	if expected := "b help "; stdout.String() != expected {
+		t.Errorf("expected %q, got %q", expected, stdout.String())
+	}
+
+	sub.HelpTemplate = `{{.Missing`
+	if err := sub.PrintHelp(); err == nil {
+		t.Errorf("expected a template error")
+	}
+}
+
+func TestPrintHelpWrap(t *testing.T) {
+	t.Parallel()
+
+	var verbose bool
+	var name string
+	var stdout strings.Builder
+	argp := New("A description that is long enough to be wrapped at the terminal width.")
+	argp.Name = "prog"
+	argp.Stdout = &stdout
+	argp.LookupEnv = func(key string) (string, bool) {
+		if key == "COLUMNS" {
+			return "40", true
+		}
+		return "", false
+	}
+	argp.AddOpt(&verbose, "v", "verbose", "Print more output about what is going on")
+	argp.AddOpt(&name, "", "名前", "Name of the 世界 to greet politely")
+
+	if err := argp.PrintHelp(); err != nil {
+		t.Fatalf("print help: %v", err)
+	}
+
+	expected := `Usage: prog [options]
+
+A description that is long enough to be
+wrapped at the terminal width.
+
+Options:
+  -h, --help        Help
+  -v, --verbose     Print more output
+                    about what is going
+                    on
+      --名前 string Name of the 世界 to
+                    greet politely
+`
+	if got := stdout.String(); got != expected {
+		t.Errorf("mismatch:\nexpected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestWrap(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		text   string
+		indent int
+		width  int
+		result string
+	}{
+		{"", 0, 80, ""},
+		{"short", 4, 80, "short"},
+		{"one two three", 0, 20, "one two three"},
+		{"one two three four five six", 0, 20, "one two three four\nfive six"},
+		{"one two three four five six", 30, 40, "one two three four\n" + strings.Repeat(" ", 30) + "five six"},
+		{"line one\nline two", 2, 80, "line one\n  line two"},
+		{"世界世界世界世界世界 世界", 0, 20, "世界世界世界世界世界\n世界"},
+		{"🚀🚀🚀🚀🚀⚡✅✨ 🚀🚀", 0, 20, "🚀🚀🚀🚀🚀⚡✅✨\n🚀🚀"},
+		{"☀☀☀☀☀☀☀☀☀☀☀☀☀☀☀☀ ☀☀☀", 0, 20, "☀☀☀☀☀☀☀☀☀☀☀☀☀☀☀☀ ☀☀☀"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.text, func(t *testing.T) {
+			t.Parallel()
+
+			if result := wrap(testCase.text, testCase.indent, testCase.width); result != testCase.result {
+				t.Errorf("expected %q, got %q", testCase.result, result)
+			}
+		})
+	}
+}
+
+type SSections struct {
+	Verbose bool   `short:"v" desc:"Verbose output"`
+	Port    int    `section:"Network" desc:"Port to listen on"`
+	Host    string `section:"Network" desc:"Host to listen on"`
+	Cert    string `section:"TLS" desc:"Certificate file"`
+	Addr    string `section:"Network" desc:"Address"`
+}
+
+func (_ *SSections) Run() error {
+	return nil
+}
+
+func TestPrintHelpSections(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		declarationOrder bool
+		expected         string
+	}{
+		{false, `Usage: prog [options]
+
+Options:
+  -h, --help    Help
+  -v, --verbose Verbose output
+
+Network:
+      --addr string Address
+      --host string Host to listen on
+      --port int    Port to listen on
+
+TLS:
+      --cert string Certificate file
+
+Debugging:
+      --trace Trace output
+`},
+		{true, `Usage: prog [options]
+
+Options:
+  -v, --verbose Verbose output
+  -h, --help    Help
+
+Network:
+      --port int    Port to listen on
+      --host string Host to listen on
+      --addr string Address
+
+TLS:
+      --cert string Certificate file
+
+Debugging:
+      --trace Trace output
+`},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(fmt.Sprintf("%v", testCase.declarationOrder), func(t *testing.T) {
+			t.Parallel()
+
+			var trace bool
+			var stdout strings.Builder
+			argp := NewCmd(&SSections{}, "")
+			argp.Name = "prog"
+			argp.Stdout = &stdout
+			argp.DeclarationOrder = testCase.declarationOrder
+			argp.AddSectionOpt("Debugging", &trace, "", "trace", "Trace output")
+
+			if err := argp.PrintHelp(); err != nil {
+				t.Fatalf("print help: %v", err)
+			}
+			if got := stdout.String(); got != testCase.expected {
+				t.Errorf("mismatch:\nexpected:\n%s\ngot:\n%s", testCase.expected, got)
+			}
+		})
+	}
+}
+
+func TestPrintHelpExamples(t *testing.T) {
+	t.Parallel()
+
+	var stdout strings.Builder
+	argp := New("Short description")
+	argp.Name = "prog"
+	argp.Stdout = &stdout
+	argp.HelpWidth = 40
+	argp.LongDescription = "A longer description of the command.\nIt spans multiple lines."
+	argp.Examples = []Example{
+		{"prog --help", "Show the help, which includes this example and a rather long explanation."},
+		{"prog", ""},
+	}
+	argp.Epilogue = "Report bugs to the issue tracker."
+	sub := argp.AddCmd(&SSub1{}, "sub", "Sub description")
+	sub.LongDescription = "The long sub description."
+
+	if err := argp.PrintHelp(); err != nil {
+		t.Fatalf("print help: %v", err)
+	}
+
+	expected := `Usage: prog [options] [command] ...
+
+A longer description of the command.
+It spans multiple lines.
+
+Options:
+  -h, --help Help
+
+Commands:
+  sub       Sub description
+
+Examples:
+  prog --help
+      Show the help, which includes this
+      example and a rather long
+      explanation.
+  prog
+
+Report bugs to the issue tracker.
+`
+	if got := stdout.String(); got != expected {
+		t.Errorf("mismatch:\nexpected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestHelpCmd(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		arguments []string
+		expected  string
+		error     error
+	}{
+		{[]string{"help", "deploy"}, "Usage: prog deploy [options]\n", nil},
+		{[]string{"help", "dep"}, "Usage: prog deploy [options]\n", nil},
+		{[]string{"help", "group", "sub"}, "Usage: prog group sub [options]\n", nil},
+		{[]string{"help", "environment"}, "PROG_HOME sets the home directory.\n", nil},
+		{[]string{"help"}, "Usage: prog [options] [command] ...\n", nil},
+		{[]string{"help", "deplyo"}, "", argpErrors.ErrUnknownCommand},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(fmt.Sprintf("%v", testCase.arguments), func(t *testing.T) {
+			t.Parallel()
+
+			var stdout strings.Builder
+			argp := New("")
+			argp.Name = "prog"
+			argp.Stdout = &stdout
+			argp.AllowAbbreviation = true
+			argp.AddCmd(&SSub1{}, "deploy", "Deploy")
+			argp.AddCmd(nil, "group", "Group").AddCmd(&SSub2{}, "sub", "Sub")
+			argp.AddHelpTopic("environment", "Environment variables", "PROG_HOME sets the home directory.")
+			argp.AddHelpCmd()
+
+			err := argp.execute(context.Background(), testCase.arguments)
+			if !errors.Is(err, testCase.error) {
+				t.Fatalf("error mismatch: expected %q, got %q", testCase.error, err)
+			}
+			if got := stdout.String(); !strings.HasPrefix(got, testCase.expected) {
+				t.Errorf("expected output starting with %q, got %q", testCase.expected, got)
+			}
+		})
+	}
+}
+
+func TestPrintHelpTopics(t *testing.T) {
+	t.Parallel()
+
+	var stdout strings.Builder
+	argp := New("")
+	argp.Name = "prog"
+	argp.Stdout = &stdout
+	argp.AddHelpTopic("environment", "Environment variables", "")
+	argp.AddHelpCmd()
+
+	if err := argp.PrintHelp(); err != nil {
+		t.Fatalf("print help: %v", err)
+	}
+
+	expected := `Usage: prog [options] [command] ...
+
+Options:
+  -h, --help Help
+
+Commands:
+  help      Show help for a command or topic
+
+Help topics:
+  environment  Environment variables
+`
+	if got := stdout.String(); got != expected {
+		t.Errorf("mismatch:\nexpected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestPrintHelpTrailing(t *testing.T) {
+	t.Parallel()
+
+	var stdout strings.Builder
+	argp := NewCmd(&SCopy{}, "")
+	argp.Name = "cp"
+	argp.Stdout = &stdout
+
+	if err := argp.PrintHelp(); err != nil {
+		t.Fatalf("print help: %v", err)
+	}
+
+	expected := "Usage: cp [options] [sources...] dest\n"
+	if got := stdout.String(); !strings.HasPrefix(got, expected) {
+		t.Errorf("expected help starting with %q, got %q", expected, got)
+	}
+}
+
+func TestPrintHelpRestCount(t *testing.T) {
+	t.Parallel()
+
+	var files []string
+	var stdout strings.Builder
+	argp := New("")
+	argp.Name = "prog"
+	argp.Stdout = &stdout
+	argp.AddRestN(&files, "FILE", "Input files", 1, 3)
+
+	if err := argp.PrintHelp(); err != nil {
+		t.Fatalf("print help: %v", err)
+	}
+
+	expected := "Usage: prog [options] file...\n"
+	if got := stdout.String(); !strings.HasPrefix(got, expected) {
+		t.Errorf("expected help starting with %q, got %q", expected, got)
+	}
+}
+
+func TestPrintHelpNargs(t *testing.T) {
+	t.Parallel()
+
+	var stdout strings.Builder
+	argp := NewCmd(&SNargs{}, "")
+	argp.Name = "prog"
+	argp.Stdout = &stdout
+
+	if err := argp.PrintHelp(); err != nil {
+		t.Fatalf("print help: %v", err)
+	}
+
+	for _, expected := range []string{"--pair string string", "-p, --point int int int", "--rename='a b' old new"} {
+		if got := stdout.String(); !strings.Contains(got, expected) {
+			t.Errorf("expected help containing %q, got %q", expected, got)
+		}
+	}
+}
+
+func TestPrintHelpOptional(t *testing.T) {
+	t.Parallel()
+
+	var stdout strings.Builder
+	argp := NewCmd(&SOptional{}, "")
+	argp.Name = "prog"
+	argp.Stdout = &stdout
+
+	if err := argp.PrintHelp(); err != nil {
+		t.Fatalf("print help: %v", err)
+	}
+
+	for _, expected := range []string{"  -c, --color[=string]", "      --level[=int]", "  -v, --verbose "} {
+		if got := stdout.String(); !strings.Contains(got, expected) {
+			t.Errorf("expected help containing %q, got %q", expected, got)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package argp
+
+import (
+	"bufio"
+	"errors"
+	motmedelErrors "github.com/Motmedel/utils_go/pkg/errors"
+	argpErrors "github.com/vphpersson/argp/pkg/errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// origin is the response file and line that an argument was read from, the file is "" for the command line.
+type origin struct {
+	file string
+	line int
+}
+
+// responseFiles expands response files into arguments.
+type responseFiles struct {
+	expanded []string
+	origins  []origin
+	stack    []string // absolute paths of the response files being expanded
+	done     bool     // set after --
+}
+
+// expandResponseFiles replaces arguments of the form @file by the arguments in the file, which are split per line like a shell. Response files may include other response files, and @@ escapes a literal @. Arguments after -- are not expanded. It returns the expanded arguments and their origins.
+func expandResponseFiles(arguments []string) ([]string, []origin, error) {
+	r := responseFiles{}
+	if err := r.expand(arguments, nil, origin{}); err != nil {
+		return nil, nil, err
+	}
+	return r.expanded, r.origins, nil
+}
+
+// expand appends the expanded arguments, which are read from the given origin with lines holding the line of each argument, or nil for the command line.
+func (r *responseFiles) expand(arguments []string, lines []int, at origin) error {
+	for i, arg := range arguments {
+		if lines != nil {
+			at.line = lines[i]
+		}
+
+		if !r.done {
+			if arg == "--" {
+				r.done = true
+			} else if strings.HasPrefix(arg, "@@") {
+				arg = arg[1:]
+			} else if 1 < len(arg) && arg[0] == '@' {
+				if err := r.expandFile(arg, at); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+
+		r.expanded = append(r.expanded, arg)
+		r.origins = append(r.origins, at)
+	}
+	return nil
+}
+
+// expandFile appends the expanded arguments of the response file of arg, which is of the form @file.
+func (r *responseFiles) expandFile(arg string, at origin) error {
+	parseError := func(err error) error {
+		return motmedelErrors.NewWithTrace(&argpErrors.ParseError{
+			Err:   argpErrors.ErrResponseFile,
+			Name:  arg,
+			Index: len(r.expanded),
+			Token: arg,
+			Cause: err,
+			File:  at.file,
+			Line:  at.line,
+		})
+	}
+
+	filename := arg[1:]
+	path, err := filepath.Abs(filename)
+	if err != nil {
+		return parseError(err)
+	} else if slices.Contains(r.stack, path) {
+		return parseError(errors.New("recursive inclusion"))
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return parseError(err)
+	}
+	defer f.Close()
+
+	var arguments []string
+	var lines []int
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		for _, argument := range splitArguments(text) {
+			arguments = append(arguments, argument)
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return parseError(err)
+	}
+
+	r.stack = append(r.stack, path)
+	defer func() {
+		r.stack = r.stack[:len(r.stack)-1]
+	}()
+	return r.expand(arguments, lines, origin{file: filename})
+}
+
+// setOrigin sets the response file and line of a parse error whose argument was read from a response file.
+func setOrigin(err error, origins []origin) {
+	var parseErr *argpErrors.ParseError
+	if errors.As(err, &parseErr) && parseErr.File == "" && 0 <= parseErr.Index && parseErr.Index < len(origins) {
+		parseErr.File = origins[parseErr.Index].file
+		parseErr.Line = origins[parseErr.Index].line
+	}
+}
@@ -0,0 +1,125 @@
+package argp
+
+import (
+	"errors"
+	"fmt"
+	"github.com/google/go-cmp/cmp"
+	argpErrors "github.com/vphpersson/argp/pkg/errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// writeResponseFiles writes the files to a temporary directory and returns the directory. DIR in the contents is replaced by the directory.
+func writeResponseFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		content = strings.ReplaceAll(content, "DIR", dir)
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestExpandResponseFiles(t *testing.T) {
+	t.Parallel()
+
+	dir := writeResponseFiles(t, map[string]string{
+		"args.txt":   "--foo 'a b'\n\n  -c \"x y\" @DIR/inner.txt\n",
+		"inner.txt":  "--bar=1\n@@literal\n",
+		"dashes.txt": "a -- @DIR/inner.txt\n",
+		"empty.txt":  "--prefix '' --verbose\n",
+	})
+	at := func(name string) string {
+		return "@" + filepath.Join(dir, name)
+	}
+
+	testCases := []struct {
+		arguments []string
+		expected  []string
+	}{
+		{[]string{"x", "@@y", "@"}, []string{"x", "@y", "@"}},
+		{[]string{at("inner.txt")}, []string{"--bar=1", "@literal"}},
+		{[]string{"-a", at("args.txt"), "z"}, []string{"-a", "--foo", "a b", "-c", "x y", "--bar=1", "@literal", "z"}},
+		{[]string{"--", at("inner.txt"), "@@x"}, []string{"--", at("inner.txt"), "@@x"}},
+		{[]string{at("dashes.txt"), at("inner.txt")}, []string{"a", "--", at("inner.txt"), at("inner.txt")}},
+		{[]string{at("empty.txt")}, []string{"--prefix", "", "--verbose"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(fmt.Sprintf("%v", testCase.arguments), func(t *testing.T) {
+			t.Parallel()
+
+			arguments, _, err := expandResponseFiles(testCase.arguments)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(testCase.expected, arguments); diff != "" {
+				t.Errorf("arguments mismatch (-expected +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestArgpResponseFileErrors(t *testing.T) {
+	t.Parallel()
+
+	dir := writeResponseFiles(t, map[string]string{
+		"values.txt":  "--string x\n--int y\n",
+		"string.txt":  "--string x\n",
+		"loop.txt":    "--bool\n@DIR/loop2.txt\n",
+		"loop2.txt":   "\n@DIR/loop.txt\n",
+		"missing.txt": "@DIR/none.txt\n",
+	})
+	at := func(name string) string {
+		return "@" + filepath.Join(dir, name)
+	}
+
+	testCases := []struct {
+		arguments []string
+		error     error
+		file      string
+		line      int
+	}{
+		{[]string{at("values.txt")}, strconv.ErrSyntax, "values.txt", 2},
+		{[]string{"--int", "1", at("loop.txt")}, argpErrors.ErrResponseFile, "loop2.txt", 2},
+		{[]string{at("missing.txt")}, fs.ErrNotExist, "missing.txt", 1},
+		{[]string{at("none.txt")}, fs.ErrNotExist, "", 0},
+		{[]string{at("string.txt"), "--bogus"}, argpErrors.ErrUnknownOption, "", 0},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(fmt.Sprintf("%v", testCase.arguments), func(t *testing.T) {
+			t.Parallel()
+
+			s := STypes{}
+			argp := NewCmd(&s, "description")
+			argp.ResponseFiles = true
+			argp.CollectErrors = true
+
+			_, err := argp.selectCmd(testCase.arguments)
+			if !errors.Is(err, testCase.error) {
+				t.Errorf("error mismatch: expected %q, got %q", testCase.error, err)
+			}
+
+			var parseErr *argpErrors.ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("expected a ParseError, got %q", err)
+			}
+			file := ""
+			if parseErr.File != "" {
+				file = filepath.Base(parseErr.File)
+			}
+			if file != testCase.file || parseErr.Line != testCase.line {
+				t.Errorf("expected %v:%v, got %v:%v", testCase.file, testCase.line, file, parseErr.Line)
+			}
+			if testCase.file != "" && !strings.HasPrefix(err.Error(), fmt.Sprintf("%s:%d: ", parseErr.File, testCase.line)) {
+				t.Errorf("expected message citing %v:%v, got %q", testCase.file, testCase.line, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package argp
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// suggest returns the candidates that are close to name, the closest first. Candidates may be prefixed with dashes, which are ignored in the comparison.
+func suggest(name string, candidates []string) []string {
+	name = strings.ToLower(strings.TrimLeft(name, "-"))
+	if name == "" {
+		return nil
+	}
+
+	maxDistance := (utf8.RuneCountInString(name) + 1) / 3
+	distances := map[string]int{}
+	var suggestions []string
+	for _, candidate := range candidates {
+		if _, ok := distances[candidate]; ok {
+			continue
+		}
+		other := strings.ToLower(strings.TrimLeft(candidate, "-"))
+		d := editDistance(name, other)
+		if d <= maxDistance || 1 < len(name) && strings.HasPrefix(other, name) {
+			distances[candidate] = d
+			suggestions = append(suggestions, candidate)
+		}
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if di, dj := distances[suggestions[i]], distances[suggestions[j]]; di != dj {
+			return di < dj
+		}
+		return suggestions[i] < suggestions[j]
+	})
+	return suggestions
+}
+
+// editDistance returns the number of rune insertions, deletions, substitutions and transpositions of adjacent runes needed to turn a into b.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	rows := make([][]int, len(ra)+1)
+	for i := range rows {
+		rows[i] = make([]int, len(rb)+1)
+		rows[i][0] = i
+	}
+	for j := range rows[0] {
+		rows[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			rows[i][j] = min(rows[i-1][j]+1, rows[i][j-1]+1, rows[i-1][j-1]+cost)
+			if 1 < i && 1 < j && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				rows[i][j] = min(rows[i][j], rows[i-2][j-2]+1)
+			}
+		}
+	}
+	return rows[len(ra)][len(rb)]
+}
@@ -1,6 +1,10 @@
 package errors
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
 
 var (
 	ErrUnknownOption = errors.New("unknown option")
@@ -8,4 +12,75 @@ var (
 	ErrUnexpectedInput = errors.New("unexpected input")
 	ErrShowHelp = errors.New("show help")
 	ErrMissingValue = errors.New("missing value")
+	ErrAmbiguousOption = errors.New("ambiguous option")
+	ErrAmbiguousCommand = errors.New("ambiguous command")
+	ErrUnknownCommand = errors.New("unknown command")
+	ErrMissingCommand = errors.New("missing command")
+	ErrInvalidValue = errors.New("invalid value")
+	ErrResponseFile = errors.New("invalid response file")
+	ErrCount = errors.New("wrong number of values")
 )
+
+// ParseError is an error for a command line argument.
+type ParseError struct {
+	Err   error  // one of the errors above, e.g. ErrUnknownOption
+	Name  string // option name with dashes, argument or command name, "" if not known
+	Index int    // index of Token in the parsed arguments, i.e. os.Args[1:] with response files expanded
+	Token string // the argument as given
+	Type  string // expected type of the value, "" if not known
+	Cause error  // underlying error, nil if not known
+	File  string // response file that Token was read from, "" if it was given on the command line
+	Line  int    // line of Token in File
+}
+
+func (e *ParseError) Error() string {
+	var msg string
+	var suggestionErr *SuggestionError
+	if errors.As(e.Cause, &suggestionErr) {
+		msg = suggestionErr.Error()
+	} else {
+		msg = e.Err.Error()
+		if e.Name != "" {
+			msg = e.Name + ": " + msg
+		}
+		if e.Type != "" {
+			msg += " (expected " + e.Type + ")"
+		}
+		if e.Cause != nil {
+			msg += ": " + e.Cause.Error()
+		} else if e.Token != "" {
+			msg += ": " + e.Token
+		}
+	}
+
+	if e.File != "" {
+		msg = fmt.Sprintf("%s:%d: %s", e.File, e.Line, msg)
+	}
+	return msg
+}
+
+func (e *ParseError) Unwrap() []error {
+	if e.Cause == nil {
+		return []error{e.Err}
+	}
+	return []error{e.Err, e.Cause}
+}
+
+// SuggestionError is an error for an unknown option or command name that carries the known names closest to it.
+type SuggestionError struct {
+	Err         error
+	Name        string
+	Suggestions []string
+}
+
+func (e *SuggestionError) Error() string {
+	msg := fmt.Sprintf("%v: %s", e.Err, e.Name)
+	if 0 < len(e.Suggestions) {
+		msg += "; did you mean " + strings.Join(e.Suggestions, ", ") + "?"
+	}
+	return msg
+}
+
+func (e *SuggestionError) Unwrap() error {
+	return e.Err
+}
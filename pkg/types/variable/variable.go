@@ -9,9 +9,20 @@ type Variable struct {
 	Short       rune // 0 if not used
 	Index       int  // -1 if not used
 	Rest        bool
+	Trailing    int // position of an argument after the rest from the end, 1 for the last, 0 if not used
 	Default     any // nil is not used
 	Description string
 	IsSet       bool
+	Persistent  bool   // also accepted by sub commands
+	Section     string // help section, "" if not used
+	PassThrough bool   // collects unknown options
+	Min         int    // minimum number of occurrences of an option or values of the rest
+	Max         int    // maximum number of occurrences of an option or values of the rest, 0 if not used
+	Positions   []int  // indices of the arguments that set the variable
+	Nargs       int    // number of arguments taken by an option for its elements or fields, 0 if not used
+	Optional    bool   // takes a value only when attached with =, e.g. --color=never
+	Implicit    string // value of an optional option given without a value
+	NextBool    bool   // a bool option given without a value takes a following true or false, e.g. --dry-run false
 }
 
 // IsOption returns true for an option.
@@ -21,7 +32,7 @@ func (v *Variable) IsOption() bool {
 
 // IsArgument returns true for an argument.
 func (v *Variable) IsArgument() bool {
-	return v.Index != -1 || v.Rest
+	return v.Index != -1 || v.Rest || v.Trailing != 0 || v.PassThrough
 }
 
 // Set sets the variable's value.